@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Talks to the AuctionAdmin service of the replicas, so operators do not have to write code, ex.
+// go run ./auctionctl auctions list
+// go run ./auctionctl auction create -reserve 100 -duration 5m car
+// Changes are sent to every replica, like bids are, while lists are read from the first replica that answers.
+
+// a command is run with the arguments after its name, and returns the exit code
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"auctions list":    {"list the auctions", listAuctions},
+	"auction create":   {"[-reserve amount] [-duration 5m] [-draft | -starts-at time] [id] - create an auction, with a random id if none is given", createAuction},
+	"auction schedule": {"[-starts-at time] [id] - make a draft auction open by itself at a time", scheduleAuction},
+	"auction open":     {"[id] - open a draft or scheduled auction now", openAuction},
+	"auction show":     {"[id] - show an auction and every change of its state", showAuction},
+	"auction close":    {"[id] - end an auction now, the highest bid so far wins", closeAuction},
+	"auction cancel":   {"[-reason text] [id] - end an auction now without a winner", cancelAuction},
+	"auction pause":    {"[id] - stop the clock of an auction and turn down bids", pauseAuction},
+	"auction resume":   {"[id] - start the clock of a paused auction again", resumeAuction},
+	"cluster status":   {"show the health, peers and audit log position of every replica", clusterStatus},
+	"bidder ban":       {"[-reason text] [name] - disconnect a bidder and turn down everything they do", banBidder},
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1] + " " + os.Args[2]
+	if name == "auction list" {
+		name = "auctions list"
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[3:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: auctionctl [command] [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "every command takes -servers, -output (table or json), -token-file, -timeout and -tls-ca/-tls-cert/-tls-key, see auctionctl [command] -h")
+}
+
+// the flags every command has
+type options struct {
+	servers   *string
+	output    *string
+	tokenFile *string
+	timeout   *time.Duration
+	tlsCA     *string
+	tlsCert   *string
+	tlsKey    *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet("auctionctl "+name, flag.ExitOnError)
+	return fs, &options{
+		servers:   fs.String("servers", "localhost:5000,localhost:5001,localhost:5002", "comma separated addresses of the replicas"),
+		output:    fs.String("output", "table", "output format: table or json"),
+		tokenFile: fs.String("token-file", "", "file with the admin token, needed when the servers have -admin-token"),
+		timeout:   fs.Duration("timeout", 5*time.Second, "how long to wait for each replica"),
+		tlsCA:     fs.String("tls-ca", "", "CA certificate to verify the servers with, enables TLS"),
+		tlsCert:   fs.String("tls-cert", "", "client certificate, only needed if the servers ask for one"),
+		tlsKey:    fs.String("tls-key", "", "private key for -tls-cert"),
+	}
+}
+
+// parses args, where flags may come before or after the positional arguments, ex. "car -reserve 100"
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// a connection to the admin service of one replica
+type replica struct {
+	addr   string
+	client gRPC.AuctionAdminClient
+}
+
+func (o *options) dial() ([]replica, func(), error) {
+	creds, err := o.credentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	var replicas []replica
+	var conns []*grpc.ClientConn
+	for _, addr := range strings.Split(*o.servers, ",") {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, nil, err
+		}
+		conns = append(conns, conn)
+		replicas = append(replicas, replica{addr: addr, client: gRPC.NewAuctionAdminClient(conn)})
+	}
+	return replicas, func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}, nil
+}
+
+func (o *options) credentials() (credentials.TransportCredentials, error) {
+	if *o.tlsCA == "" {
+		return insecure.NewCredentials(), nil
+	}
+	data, err := os.ReadFile(*o.tlsCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", *o.tlsCA)
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if *o.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*o.tlsCert, *o.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// the context for a call to one replica, with the admin token if there is one
+func (o *options) context() (context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *o.timeout)
+	if *o.tokenFile != "" {
+		token, err := os.ReadFile(*o.tokenFile)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return ctx, cancel, nil
+}
+
+// the answer of one replica to a call
+type result struct {
+	addr     string
+	response proto.Message
+	err      error
+}
+
+// calls every replica at once and returns their answers in the order of -servers
+func (o *options) fanOut(replicas []replica, call func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error)) []result {
+	results := make([]result, len(replicas))
+	done := make(chan struct{})
+	for i, r := range replicas {
+		go func(i int, r replica) {
+			defer func() { done <- struct{}{} }()
+			results[i].addr = r.addr
+			ctx, cancel, err := o.context()
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			defer cancel()
+			results[i].response, results[i].err = call(ctx, r.client)
+		}(i, r)
+	}
+	for range replicas {
+		<-done
+	}
+	return results
+}
+
+// runs a change on every replica and prints how it went on each, the exit code is 1 if any replica failed
+func change(o *options, call func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error)) int {
+	replicas, closeAll, err := o.dial()
+	if err != nil {
+		return fail(err)
+	}
+	defer closeAll()
+
+	results := o.fanOut(replicas, call)
+	if err := printResults(*o.output, results); err != nil {
+		return fail(err)
+	}
+	for _, r := range results {
+		if r.err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "auctionctl:", err)
+	return 1
+}
+
+// the message of a gRPC error, without the "rpc error: code = ..." around it
+func errorText(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return st.Code().String() + ": " + st.Message()
+	}
+	return err.Error()
+}
+
+func listAuctions(args []string) int {
+	fs, o := newFlagSet("auctions list")
+	if len(parseArgs(fs, args)) > 0 {
+		return fail(errors.New("auctions list takes no arguments"))
+	}
+	return readAuctions(o, func(response *gRPC.ListAuctionsResponse) error {
+		return printAuctions(*o.output, response)
+	})
+}
+
+func showAuction(args []string) int {
+	fs, o := newFlagSet("auction show")
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		return fail(errors.New("auction show takes the id of the auction"))
+	}
+	return readAuctions(o, func(response *gRPC.ListAuctionsResponse) error {
+		for _, a := range response.Auctions {
+			if a.Id == positional[0] {
+				return printAuction(*o.output, a)
+			}
+		}
+		return fmt.Errorf("there is no auction %q", positional[0])
+	})
+}
+
+// gets the auctions from the first replica that answers and hands them to show
+func readAuctions(o *options, show func(*gRPC.ListAuctionsResponse) error) int {
+	replicas, closeAll, err := o.dial()
+	if err != nil {
+		return fail(err)
+	}
+	defer closeAll()
+
+	// the replicas have the same auctions, so the first one that answers is enough
+	for _, r := range replicas {
+		ctx, cancel, err := o.context()
+		if err != nil {
+			return fail(err)
+		}
+		response, err := r.client.ListAuctions(ctx, &gRPC.ListAuctionsRequest{})
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", r.addr, errorText(err))
+			continue
+		}
+		if err := show(response); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+	return fail(errors.New("no replica answered"))
+}
+
+func createAuction(args []string) int {
+	fs, o := newFlagSet("auction create")
+	reserve := fs.Int64("reserve", 0, "the lowest bid that is accepted")
+	duration := fs.Duration("duration", 0, "how long the auction is open, 0 for the servers -auction-duration")
+	draft := fs.Bool("draft", false, "create it as a draft, that has to be scheduled or opened later")
+	startsAt := fs.String("starts-at", "", "when the auction opens, ex. 2024-05-01T18:00:00+02:00 or 10m for in 10 minutes, empty for now")
+	positional := parseArgs(fs, args)
+	if len(positional) > 1 {
+		return fail(errors.New("auction create takes at most one id"))
+	}
+	starts, err := parseStart(*startsAt)
+	if err != nil {
+		return fail(err)
+	}
+
+	// every replica has to get the same id, so a missing one is made up here and not by the servers
+	b := make([]byte, 4)
+	rand.Read(b)
+	id := "auction-" + hex.EncodeToString(b)
+	if len(positional) == 1 {
+		id = positional[0]
+	}
+	request := &gRPC.CreateAuctionRequest{Id: id, Reserve: *reserve, DurationMs: duration.Milliseconds(), Draft: *draft, StartsAt: starts}
+	return change(o, func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error) {
+		return client.CreateAuction(ctx, request)
+	})
+}
+
+// parses a time as RFC 3339, or as a duration from now, into unix milliseconds. Empty is 0.
+func parseStart(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d).UnixMilli(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("-starts-at %q is neither a time like 2024-05-01T18:00:00+02:00 nor a duration like 10m", value)
+	}
+	return t.UnixMilli(), nil
+}
+
+func scheduleAuction(args []string) int {
+	fs, o := newFlagSet("auction schedule")
+	startsAt := fs.String("starts-at", "", "when the auction opens, ex. 2024-05-01T18:00:00+02:00 or 10m for in 10 minutes")
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		return fail(errors.New("auction schedule takes the id of the auction"))
+	}
+	// parsed once, so every replica gets the same time
+	starts, err := parseStart(*startsAt)
+	if err != nil {
+		return fail(err)
+	}
+	if starts == 0 {
+		return fail(errors.New("auction schedule needs -starts-at"))
+	}
+	request := &gRPC.ScheduleAuctionRequest{Id: positional[0], StartsAt: starts}
+	return change(o, func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error) {
+		return client.ScheduleAuction(ctx, request)
+	})
+}
+
+func openAuction(args []string) int {
+	return auctionChange("auction open", args, gRPC.AuctionAdminClient.OpenAuction)
+}
+
+func closeAuction(args []string) int {
+	return auctionChange("auction close", args, gRPC.AuctionAdminClient.CloseAuction)
+}
+
+func cancelAuction(args []string) int {
+	return auctionChange("auction cancel", args, gRPC.AuctionAdminClient.CancelAuction)
+}
+
+func pauseAuction(args []string) int {
+	return auctionChange("auction pause", args, gRPC.AuctionAdminClient.PauseAuction)
+}
+
+func resumeAuction(args []string) int {
+	return auctionChange("auction resume", args, gRPC.AuctionAdminClient.ResumeAuction)
+}
+
+// runs a call that takes the id of an auction on every replica
+func auctionChange(name string, args []string, call func(gRPC.AuctionAdminClient, context.Context, *gRPC.AuctionRequest, ...grpc.CallOption) (*gRPC.AuctionInfo, error)) int {
+	fs, o := newFlagSet(name)
+	var reason *string
+	if name == "auction cancel" {
+		reason = fs.String("reason", "", "why the auction is cancelled, kept in the audit log")
+	}
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		return fail(errors.New(name + " takes the id of the auction"))
+	}
+	request := &gRPC.AuctionRequest{Id: positional[0]}
+	if reason != nil {
+		request.Reason = *reason
+	}
+	return change(o, func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error) {
+		return call(client, ctx, request)
+	})
+}
+
+func banBidder(args []string) int {
+	fs, o := newFlagSet("bidder ban")
+	reason := fs.String("reason", "", "why the bidder is banned, kept in the audit log")
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		return fail(errors.New("bidder ban takes the name of the bidder"))
+	}
+	request := &gRPC.BanBidderRequest{Name: positional[0], Reason: *reason}
+	return change(o, func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error) {
+		return client.BanBidder(ctx, request)
+	})
+}
+
+func clusterStatus(args []string) int {
+	fs, o := newFlagSet("cluster status")
+	if len(parseArgs(fs, args)) > 0 {
+		return fail(errors.New("cluster status takes no arguments"))
+	}
+	replicas, closeAll, err := o.dial()
+	if err != nil {
+		return fail(err)
+	}
+	defer closeAll()
+
+	results := o.fanOut(replicas, func(ctx context.Context, client gRPC.AuctionAdminClient) (proto.Message, error) {
+		return client.GetReplicaState(ctx, &gRPC.ReplicaStateRequest{})
+	})
+	if err := printStatus(*o.output, results); err != nil {
+		return fail(err)
+	}
+	// unreachable replicas are part of the status, not a failure of the command
+	return 0
+}
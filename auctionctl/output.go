@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var jsonOptions = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// the json output of a call to one replica
+type jsonResult struct {
+	Replica  string          `json:"replica"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func checkFormat(format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown output format %q, use table or json", format)
+	}
+	return nil
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func printAuctions(format string, response *gRPC.ListAuctionsResponse) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if format == "json" {
+		data, err := jsonOptions.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return printJSON(json.RawMessage(data))
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "ID\tSTATE\tRESERVE\tDURATION\tHIGHEST BID\tBIDDER\tSTARTS\tENDS")
+	for _, a := range response.Auctions {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n", a.Id, a.State, a.Reserve,
+			time.Duration(a.DurationMs)*time.Millisecond, a.Amount, orDash(a.Bidder), formatTime(a.StartsAt), ends(a))
+	}
+	return table.Flush()
+}
+
+// prints one auction and its history
+func printAuction(format string, a *gRPC.AuctionInfo) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if format == "json" {
+		data, err := jsonOptions.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return printJSON(json.RawMessage(data))
+	}
+
+	table := newTable()
+	fmt.Fprintf(table, "ID\t%s\n", a.Id)
+	fmt.Fprintf(table, "STATE\t%s\n", a.State)
+	fmt.Fprintf(table, "RESERVE\t%d\n", a.Reserve)
+	fmt.Fprintf(table, "DURATION\t%s\n", time.Duration(a.DurationMs)*time.Millisecond)
+	fmt.Fprintf(table, "HIGHEST BID\t%d\n", a.Amount)
+	fmt.Fprintf(table, "BIDDER\t%s\n", orDash(a.Bidder))
+	fmt.Fprintf(table, "STARTS\t%s\n", formatTime(a.StartsAt))
+	fmt.Fprintf(table, "ENDS\t%s\n", ends(a))
+	if a.Order != nil {
+		settled := "not settled yet"
+		if a.Order.SettledAt != 0 {
+			settled = "settled by " + a.Order.SettledBy + " at " + formatTime(a.Order.SettledAt)
+		}
+		fmt.Fprintf(table, "ORDER\t%s, %s\n", a.Order.Id, settled)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	table = newTable()
+	fmt.Fprintln(table, "TIME\tFROM\tTO\tREASON")
+	for _, e := range a.History {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", time.UnixMilli(e.At).Format("2006-01-02 15:04:05"), e.From, e.To, orDash(e.Reason))
+	}
+	return table.Flush()
+}
+
+// when the auction ends, or how much time it has left if it is paused
+func ends(a *gRPC.AuctionInfo) string {
+	if a.RemainingMs > 0 {
+		return (time.Duration(a.RemainingMs) * time.Millisecond).Round(time.Second).String() + " left"
+	}
+	return formatTime(a.EndsAt)
+}
+
+// prints how a change went on each replica
+func printResults(format string, results []result) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if format == "json" {
+		return printJSON(jsonResults(results))
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "REPLICA\tRESULT")
+	for _, r := range results {
+		outcome := "ok"
+		if r.err != nil {
+			outcome = errorText(r.err)
+		} else if a, ok := r.response.(*gRPC.AuctionInfo); ok {
+			outcome = fmt.Sprintf("ok, %s is %s, highest bid %d", a.Id, a.State, a.Amount)
+		}
+		fmt.Fprintf(table, "%s\t%s\n", r.addr, outcome)
+	}
+	return table.Flush()
+}
+
+func printStatus(format string, results []result) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if format == "json" {
+		return printJSON(jsonResults(results))
+	}
+
+	// the errors of unreachable replicas are long, so they go below the table
+	var unreachable []string
+	table := newTable()
+	fmt.Fprintln(table, "REPLICA\tID\tHEALTH\tPEERS UP\tLOG SEQ\tLOG HASH\tAUCTIONS\tOPEN\tSUBSCRIBERS\tBANNED")
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(table, "%s\t-\tUNREACHABLE\t-\t-\t-\t-\t-\t-\t-\n", r.addr)
+			unreachable = append(unreachable, r.addr+": "+errorText(r.err))
+			continue
+		}
+		s := r.response.(*gRPC.ReplicaState)
+		health := s.Health
+		if s.Recovering {
+			health += " (recovering)"
+		} else if s.Draining {
+			health += " (draining)"
+		}
+		live := 0
+		for _, p := range s.Peers {
+			if p.Live {
+				live++
+			}
+		}
+		hash := s.LogHash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d/%d\t%d\t%s\t%d\t%d\t%d\t%s\n", r.addr, s.ReplicaId, health, live, len(s.Peers),
+			s.LogSeq, orDash(hash), s.Auctions, s.OpenAuctions, s.Subscribers, orDash(strings.Join(s.Banned, ",")))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	for _, line := range unreachable {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return nil
+}
+
+func jsonResults(results []result) []jsonResult {
+	list := make([]jsonResult, len(results))
+	for i, r := range results {
+		list[i] = jsonResult{Replica: r.addr, OK: r.err == nil}
+		if r.err != nil {
+			list[i].Error = errorText(r.err)
+			continue
+		}
+		if data, err := jsonOptions.Marshal(r.response); err == nil {
+			list[i].Response = data
+		}
+	}
+	return list
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formats unix milliseconds, 0 means the time is not set
+func formatTime(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	t := time.UnixMilli(ms)
+	if time.Until(t) > 0 {
+		return t.Format("15:04:05") + " (in " + strconv.Itoa(int(time.Until(t).Seconds())) + "s)"
+	}
+	return t.Format("15:04:05")
+}
@@ -0,0 +1,151 @@
+// Package audit is an append-only log of everything that happens to bids.
+// Every entry holds the hash of the entry before it, so changing, removing or
+// reordering entries breaks the chain and is found by Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The kinds of events that are recorded
+const (
+	Attempt   = "attempt"   // a bid reached the server
+	Accepted  = "accepted"  // the bid became the highest bid
+	Rejected  = "rejected"  // the bid was turned down, Reason says why
+	Retracted = "retracted" // the bidder took back their highest bid, Amount is the bid
+	Closed    = "closed"    // the auction ended, Bidder and Amount are the winning bid
+	Settled   = "settled"   // the post-close hooks of the auction have run, Reason says on which replica
+	Created   = "created"   // an operator created the auction, Amount is the reserve price
+	Scheduled = "scheduled" // the auction will open by itself, Reason says when
+	Opened    = "opened"    // the auction started taking bids
+	Banned    = "banned"    // an operator banned the bidder, Reason says why
+	Paused    = "paused"    // an operator paused the auction
+	Resumed   = "resumed"   // an operator resumed the auction
+	Cancelled = "cancelled" // an operator cancelled the auction, there is no winner, Reason says why
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Replica  string    `json:"replica"`
+	Event    string    `json:"event"`
+	Auction  string    `json:"auction"`
+	Bidder   string    `json:"bidder,omitempty"`
+	Amount   int64     `json:"amount"`
+	Reason   string    `json:"reason,omitempty"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+// hash of the entry with its own Hash field left out
+func (e Entry) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log appends entries to a file, continuing the chain already in it
+type Log struct {
+	mu       sync.Mutex
+	f        *os.File
+	replica  string
+	seq      uint64
+	lastHash string
+}
+
+// Open opens or creates the audit log at path. An existing log is verified first,
+// so new entries are never chained onto a log that has been tampered with.
+func Open(path string, replica string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	last, err := Verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Log{f: f, replica: replica, seq: last.Seq, lastHash: last.Hash}, nil
+}
+
+// Append fills in the sequence number, time, replica and hashes of e, and writes it to disk
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.Replica = l.replica
+	e.PrevHash = l.lastHash
+	e.Hash = e.hash()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.seq = e.Seq
+	l.lastHash = e.Hash
+	return nil
+}
+
+// Close flushes the log to disk and closes it
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// Position returns the sequence number and hash of the last entry written
+func (l *Log) Position() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.lastHash
+}
+
+// Verify reads a whole audit log and checks that every entry has the right hash, points to the
+// entry before it and has the next sequence number. It returns the last entry, which can be
+// compared with a copy kept elsewhere to find entries cut off the end of the log.
+func Verify(r io.Reader) (Entry, error) {
+	var last Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return last, fmt.Errorf("line %d: not a valid entry: %v", line, err)
+		}
+		if e.Seq != last.Seq+1 {
+			return last, fmt.Errorf("line %d: expected entry %d, found %d", line, last.Seq+1, e.Seq)
+		}
+		if e.PrevHash != last.Hash {
+			return last, fmt.Errorf("line %d: entry %d does not follow entry %d", line, e.Seq, last.Seq)
+		}
+		if e.Hash != e.hash() {
+			return last, fmt.Errorf("line %d: entry %d has been changed", line, e.Seq)
+		}
+		last = e
+	}
+	return last, scanner.Err()
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writes a log with three entries and returns its lines
+func writeLog(t *testing.T) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{Event: Attempt, Auction: "default", Bidder: "alice", Amount: 100},
+		{Event: Accepted, Auction: "default", Bidder: "alice", Amount: 100},
+		{Event: Closed, Auction: "default", Bidder: "alice", Amount: 100},
+	} {
+		if err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(lines []string) []string
+		wantSeq uint64
+		wantErr string
+	}{
+		{"untouched", func(lines []string) []string { return lines }, 3, ""},
+		{"cut off the end", func(lines []string) []string { return lines[:2] }, 2, ""},
+		{"changed", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"amount":100`, `"amount":1000`, 1)
+			return lines
+		}, 1, "entry 2 has been changed"},
+		{"removed", func(lines []string) []string { return append(lines[:1], lines[2:]...) }, 1, "expected entry 2, found 3"},
+		{"reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 1, "expected entry 2, found 3"},
+		{"not json", func(lines []string) []string { return append(lines, "{") }, 3, "line 4: not a valid entry"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := test.change(writeLog(t))
+			last, err := Verify(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("Verify() error = %v, want %q", err, test.wantErr)
+			}
+			if last.Seq != test.wantSeq {
+				t.Errorf("Verify() last entry = %d, want %d", last.Seq, test.wantSeq)
+			}
+		})
+	}
+}
+
+// a log that is opened again goes on with the chain, and a tampered one is not opened
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		l, err := Open(path, "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Append(Entry{Event: Attempt, Auction: "default", Bidder: "bob", Amount: 5}); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := Verify(f)
+	f.Close()
+	if err != nil || last.Seq != 2 {
+		t.Fatalf("Verify() = %d, %v, want 2 entries", last.Seq, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "bob", "eve", 1)), 0644)
+	if _, err := Open(path, "0"); err == nil {
+		t.Error("Open() of a tampered log succeeded")
+	}
+}
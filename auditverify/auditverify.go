@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+)
+
+// Checks that audit logs written by the servers have not been tampered with, ex.
+// go run ./auditverify audit-0.log audit-1.log audit-2.log
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: auditverify [audit log]...")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range os.Args[1:] {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		last, err := audit.Verify(f)
+		f.Close()
+		if err != nil {
+			fmt.Printf("%s: FAILED: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok, %d entries, last hash %s\n", path, last.Seq, last.Hash)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generates a local development CA and certificates for the replicas and clients.
+// Never use these for anything but local testing.
+var outDir = flag.String("out", "certs", "folder to write the certificates to")
+var hosts = flag.String("hosts", "localhost,127.0.0.1", "comma separated host names and ips the replicas are reached on")
+var replicas = flag.Int("replicas", 3, "number of replica certificates to make")
+var clients = flag.String("clients", "", "comma separated names to make client certificates for, ex. alice,bob")
+var validFor = flag.Duration("valid-for", 365*24*time.Hour, "how long the certificates are valid")
+
+func main() {
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+
+	caKey, caCert := makeCA()
+	for i := 0; i < *replicas; i++ {
+		// replicas also dial each other, so their certificates are valid for both sides of a connection
+		makeCert("server"+strconv.Itoa(i), caKey, caCert, strings.Split(*hosts, ","),
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+	}
+	if *clients != "" {
+		for _, name := range strings.Split(*clients, ",") {
+			makeCert("client-"+name, caKey, caCert, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+		}
+	}
+	fmt.Printf("Certificates written to %s\n", *outDir)
+}
+
+func makeCA() (*ecdsa.PrivateKey, *x509.Certificate) {
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "Auction System dev CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(*validFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		log.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		log.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+	write("ca", der, key)
+	return key, cert
+}
+
+// makes a certificate signed by the CA for the given hosts
+func makeCert(name string, caKey *ecdsa.PrivateKey, caCert *x509.Certificate, hosts []string, usage []x509.ExtKeyUsage) {
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(*validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usage,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		log.Fatalf("Failed to create certificate for %s: %v", name, err)
+	}
+	write(name, der, key)
+}
+
+func newKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+func newSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Fatalf("Failed to generate serial number: %v", err)
+	}
+	return serial
+}
+
+// writes name.pem and name-key.pem to the output folder
+func write(name string, der []byte, key *ecdsa.PrivateKey) {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		log.Fatalf("Failed to encode key for %s: %v", name, err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(filepath.Join(*outDir, name+".pem"), certPEM, 0644); err != nil {
+		log.Fatalf("Failed to write certificate for %s: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		log.Fatalf("Failed to write key for %s: %v", name, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// the token from the last login and when it runs out. The servers share the signing key,
+// so one token works for all of them. Commands, the UI and the Join streams all use it, so it is guarded by tokenMu.
+var token string
+var tokenExpires time.Time
+var tokenMu sync.Mutex
+
+// the token from the last login and when it runs out, "" if the client has not logged in
+func currentToken() (string, time.Time) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	return token, tokenExpires
+}
+
+// logs in on the first server that answers
+func login() error {
+	var err error
+	for i := range servers {
+		var response *gRPC.LoginResponse
+		response, err = servers[i].Login(context.Background(), &gRPC.LoginRequest{
+			Name:     *clientsName,
+			Password: *password,
+		})
+		if err != nil {
+			slog.Warn("login failed", "server", i, "err", err)
+			continue
+		}
+		expires := time.Unix(response.ExpiresAt, 0)
+		tokenMu.Lock()
+		token, tokenExpires = response.Token, expires
+		tokenMu.Unlock()
+		slog.Info("logged in", "expires", expires)
+		return nil
+	}
+	return err
+}
+
+// returns ctx carrying the login token, logging in again if the token is about to run out.
+// Without a password the client does not log in and ctx is returned as it is.
+func authContext(ctx context.Context) context.Context {
+	if *password == "" {
+		return ctx
+	}
+	current, expires := currentToken()
+	if time.Until(expires) < time.Minute {
+		if err := login(); err != nil {
+			slog.WarnContext(ctx, "could not renew login", "err", err)
+		}
+		current, _ = currentToken()
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+current)
+}
@@ -2,19 +2,24 @@ package main
 
 import (
 	"bufio"
-	"context"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
 	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Same principle as in client. Flags allows for user specific arguments/values
@@ -22,45 +27,146 @@ var clientsName = flag.String("name", "default", "Senders name")
 var serverPort0 = flag.String("server0", "5000", "Tcp server")
 var serverPort1 = flag.String("server1", "5001", "Tcp server")
 var serverPort2 = flag.String("server2", "5001", "Tcp server")
+var tlsCAFile = flag.String("tls-ca", "", "CA certificate to verify the servers with, enables TLS")
+var tlsCertFile = flag.String("tls-cert", "", "client certificate, only needed if the servers ask for one")
+var tlsKeyFile = flag.String("tls-key", "", "private key for -tls-cert")
+var joinMode = flag.String("join-mode", "new", "what to do if the name is already in the auction: new (give up), attach (join as another device) or takeover (disconnect the other devices)")
+var metricsAddr = flag.String("metrics", "", "address to serve /metrics on, ex. localhost:9100")
+var logOutput = flag.String("log-output", "", "where to write logs: stdout, stderr or a file, defaults to client-[name].log")
+var logFormat = flag.String("log-format", "json", "log format: json or text")
+var logLevel = flag.String("log-level", "info", "lowest level to log: debug, info, warn or error")
+var traceExport = flag.String("trace-export", "", "file or OTLP/HTTP url, ex. http://localhost:4318/v1/traces, to export traces to")
+var auctionID = flag.String("auction", "default", "the auction to bid in")
+var password = flag.String("password", "", "password to log in with, needed when the servers have authentication enabled")
+var autobidStep = flag.Int64("autobid-step", 1, "how much autobid bids above the highest bid")
+var uiMode = flag.String("ui", "auto", "auto (the full-screen UI in a terminal, lines otherwise), tui or line")
 
 var servers = []gRPC.AuctionSystemClient{}
 var serverConns []*grpc.ClientConn
 
-var responseNumber = 0
-var numberOfServers = 3
-var currentMessage string
+var numberOfServers = 0 // the servers that are SERVING, see health.go, guarded by healthMu
+
+// guards *auctionID, which join and the UI change while other commands read it
+var auctionMu sync.Mutex
+
+// the auction commands go to
+func chosenAuction() string {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	return *auctionID
+}
+
+func chooseAuction(id string) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	*auctionID = id
+}
+
+// how many servers have sent each message, a message is shown once all SERVING servers have sent it.
+// Counting each message on its own means one that only some servers send, ex. the welcome
+// from a server that was rejoined, does not hold up the others.
+var responses = map[string]int{}
+var responsesMu sync.Mutex
 
 func main() {
 
 	//parse flag/arguments
 	flag.Parse()
+	flag.Usage = func() {
+		oneShotUsage()
+		flag.PrintDefaults()
+	}
+	if flag.NArg() > 0 {
+		var err error
+		if oneShot, err = parseOneShot(flag.Args()); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(exitOK)
+			}
+			fmt.Fprintln(os.Stderr, "client:", err)
+			os.Exit(exitUsage)
+		}
+	} else {
+		fmt.Println("--- Welcome to the auction---")
+	}
 
-	fmt.Println("--- Welcome to the auction---")
-
-	//log to file instead of console
-	f := setLog()
+	//log to a file of its own instead of the console
+	if *logOutput == "" {
+		*logOutput = "client-" + *clientsName + ".log"
+	}
+	_, f, err := logging.New(logging.Config{Output: *logOutput, Format: *logFormat, Level: *logLevel}, "client", *clientsName)
+	if err != nil {
+		fmt.Printf("Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
 	defer f.Close()
 
+	stopTracing := func() {}
+	if *traceExport != "" {
+		stopTracing, err = tracing.Setup("auction-client", *clientsName, *traceExport)
+		if err != nil {
+			logging.Fatal("failed to set up tracing", "dest", *traceExport, "err", err)
+		}
+	}
+	defer stopTracing()
+
+	if *metricsAddr != "" {
+		if err := registry.Serve(*metricsAddr); err != nil {
+			logging.Fatal("failed to serve metrics", "addr", *metricsAddr, "err", err)
+		}
+	}
+
 	//connect to server and close the connection when program closes
 	for i := 0; i < 3; i++ {
 		serverName := "server" + strconv.Itoa(i) // name of the server
 		serverPort := "500" + strconv.Itoa(i)    // port of the server port
-		fmt.Println("Servername: " + serverName + " - Serverport: " + serverPort)
+		if oneShot == nil {
+			fmt.Println("Servername: " + serverName + " - Serverport: " + serverPort)
+		}
 		connectToServer(serverName, serverPort)
 	}
+
+	if oneShot != nil {
+		code := oneShot.run()
+		stopTracing()
+		f.Close()
+		os.Exit(code)
+	}
+
+	if *password != "" {
+		if err := login(); err != nil {
+			fmt.Printf("Could not log in: %v\n", err)
+			logging.Fatal("could not log in", "err", err)
+		}
+	}
 	go joinChat()
 
 	// start allowing user input
+	if useTUI() {
+		err := runTUI()
+		if err == nil {
+			return
+		}
+		fmt.Println("Could not start the full-screen UI, using lines instead:", err)
+	}
 	parseAndSendInput()
 }
 
 // connect to server
 func connectToServer(serverName string, serverPort string) {
 	serverFlag := serverPort
+	creds, err := transportCredentials()
+	if err != nil {
+		logging.Fatal("failed to load TLS credentials", "err", err)
+	}
 	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithBlock(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// the connection is made in the background, the health of the server decides when it is used
+	opts = append(opts, grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor))
 
-	fmt.Printf("client %s: Attempts to dial on port %s\n", *clientsName, serverFlag)
+	if oneShot == nil {
+		fmt.Printf("client %s: Attempts to dial on port %s\n", *clientsName, serverFlag)
+	}
 	conn, err := grpc.Dial(fmt.Sprintf(":%s", serverFlag), opts...)
 	if err != nil {
 		fmt.Printf("Fail to Dial : %v", err)
@@ -72,58 +178,82 @@ func connectToServer(serverName string, serverPort string) {
 }
 
 func joinChat() {
+	mode, ok := gRPC.JoinMode_value[strings.ToUpper(*joinMode)]
+	if !ok {
+		logging.Fatal("unknown join mode", "mode", *joinMode)
+	}
 	joinRequest := &gRPC.JoinRequest{
 		Name: *clientsName,
+		Mode: gRPC.JoinMode(mode),
 	}
-	log.Println(*clientsName, "is joining the auction")
-	for i := 0; i < 3; i++ {
-		stream, _ := servers[i].Join(context.Background(), joinRequest)
-		go awaitResponse(stream)
+	for i := range servers {
+		go watchServer(i, joinRequest)
 	}
 }
 
 func awaitResponse(stream gRPC.AuctionSystem_JoinClient) {
+	// the header is sent once the server has accepted the join
+	if header, err := stream.Header(); err == nil {
+		if id := header.Get("session-id"); len(id) > 0 {
+			slog.Info("joined", "session", id[0])
+		}
+	}
+
 	for {
 		select {
 		case <-stream.Context().Done():
-			fmt.Println("Connection to server closed")
+			show("Connection to server closed")
 			return // stream is done
 		default:
 		}
 
 		incoming, err := stream.Recv()
 		if err == io.EOF {
-			fmt.Println("Server is done sending messages")
+			show("Server is done sending messages")
 			return
 		}
 		if err != nil {
-			log.Printf("Failed to receive message from channel. Port: %v", strings.Split(err.Error(), ":")[4])
+			switch status.Code(err) {
+			case codes.Unauthenticated, codes.PermissionDenied, codes.AlreadyExists:
+				show("The server refused to let you join:", status.Convert(err).Message())
+			case codes.Aborted:
+				show("Disconnected:", status.Convert(err).Message())
+			case codes.Unavailable:
+				show("Lost a server:", status.Convert(err).Message())
+			}
+			slog.Warn("failed to receive message from channel", "err", err)
 			break
 		}
 
-		if responseNumber == 0 {
-			currentMessage = incoming.Message
-		}
-		if currentMessage == incoming.Message {
-			responseNumber++
+		key := incoming.Auction + incoming.Message + strconv.FormatInt(incoming.Bid, 10)
+		serving := servingCount()
+		responsesMu.Lock()
+		responses[key]++
+		agreed := responses[key] >= serving
+		if agreed {
+			delete(responses, key)
 		}
-		if responseNumber == numberOfServers {
+		responsesMu.Unlock()
+		if agreed {
+			messagesTotal.Inc()
+			// messages about other auctions than the default one say which auction they are about
+			prefix := ""
+			if incoming.Auction != "" && incoming.Auction != "default" {
+				prefix = "[" + incoming.Auction + "] "
+			}
 			if incoming.Bid > 0 {
-				fmt.Println(incoming.Message + strconv.FormatInt(incoming.Bid, 10))
-				log.Printf(incoming.Message + strconv.FormatInt(incoming.Bid, 10) + "\n")
+				show(prefix + incoming.Message + strconv.FormatInt(incoming.Bid, 10))
 			} else {
-				fmt.Println(incoming.Message)
-				log.Printf(incoming.Message + "\n")
+				show(prefix + incoming.Message)
 			}
-			currentMessage = ""
-			responseNumber = 0
+			slog.Info("message from servers", "auction", incoming.Auction, "message", incoming.Message, "bid", incoming.Bid)
 		}
 	}
 }
 
 func parseAndSendInput() {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Type \"bid [amount]\" or \"result\" to interact with the auction system")
+	fmt.Println("Type \"bid [amount]\" to bid, or \"help\" to see the other commands")
 	fmt.Println("--------------------")
 
 	//Infinite loop to listen for clients input.
@@ -131,54 +261,43 @@ func parseAndSendInput() {
 		//Read user input to the next newline
 		input, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Printf(err.Error())
-			log.Fatal(err)
+			fmt.Println(err.Error())
+			logging.Fatal("failed to read input", "err", err)
 		}
 		input = strings.TrimSpace(input) //Trim whitespace
 
-		processInput(input)
+		if !processInput(input) {
+			return
+		}
 	}
 }
 
-// Determines if input is valid, and if its a "bid" or "result" request.
-func processInput(input string) {
-	if strings.Contains(input, "bid ") {
-		bid, _ := strconv.ParseInt(strings.Split(input, " ")[1], 10, 64)
-
-		for i := 0; i < 3; i++ {
-			response, err := servers[i].Publish(context.Background(), &gRPC.Message{
-				Sender:  *clientsName,
-				Message: "bid",
-				Bid:     bid,
-			})
-			if err != nil || response == nil {
-				log.Printf("Client %s: something went wrong with the server", *clientsName)
-				numberOfServers--
-				continue
-			}
-		}
-	} else if strings.Contains(input, "result") {
-		for i := 0; i < 3; i++ {
-			response, err := servers[i].Publish(context.Background(), &gRPC.Message{
-				Sender:  *clientsName,
-				Message: "result",
-				Bid:     -1,
-			})
-			if err != nil || response == nil {
-				numberOfServers--
-				log.Printf("Client %s: something went wrong with the server :(", *clientsName)
-				continue
-			}
-		}
+// show prints a line for the bidder, or adds it to the messages of the full-screen UI when that is on
+func show(a ...any) {
+	line := fmt.Sprintln(a...)
+	if ui != nil {
+		ui.message(strings.TrimSuffix(line, "\n"))
+		return
 	}
+	fmt.Print(line)
 }
 
-// sets the logger to use a log.txt file instead of the console
-func setLog() *os.File {
-	f, err := os.OpenFile("log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+func showf(format string, a ...any) {
+	show(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
+}
+
+// checks if err is the server rate limiting us, and if so how long it wants us to wait.
+// A rate limited server is still alive, so it should not be counted out.
+func rateLimited(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	wait := time.Second
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			wait = info.RetryDelay.AsDuration()
+		}
 	}
-	log.SetOutput(f)
-	return f
+	return wait, true
 }
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A command is a line the bidder types: the name of the command and its arguments separated by spaces,
+// ex. "bid 150" or "join car".
+type command struct {
+	name     string
+	args     string // ex. "<amount>", for the usage
+	usage    string
+	min, max int // how many arguments it takes
+	run      func(ctx context.Context, args []string) error
+}
+
+// set in init, as help goes through the commands
+var commands []command
+
+func init() {
+	commands = []command{
+		{"bid", "<amount>", "bid in the auction", 1, 1, bid},
+		{"result", "", "ask for the highest bid, or who won", 0, 0, result},
+		{"retract", "", "take back your bid if it is the highest bid", 0, 0, retract},
+		{"history", "", "list every accepted bid of the auction", 0, 0, history},
+		{"auctions", "", "list the auctions", 0, 0, listAuctions},
+		{"join", "<auction>", "bid in another auction", 1, 1, join},
+		{"watch", "[off]", "print the updates of the auction as they happen", 0, 1, watch},
+		{"autobid", "<max>|off", "outbid everyone else by -autobid-step, up to max", 1, 1, autobid},
+		{"status", "", "show the servers, the auction and what is running", 0, 0, printStatus},
+		{"help", "", "list the commands", 0, 0, help},
+		{"quit", "", "leave", 0, 0, nil},
+	}
+}
+
+var errNoServer = status.Error(codes.Unavailable, "no server is available right now, try again in a moment")
+
+// what watch and autobid are doing, if anything
+var (
+	runningMu     sync.Mutex
+	watching      string // the auction
+	stopWatching  context.CancelFunc
+	autobidding   string // the auction
+	autobidMax    int64
+	stopAutobid   context.CancelFunc
+	autobidRounds int // tells an autobid that was stopped from the one that replaced it
+)
+
+// processInput runs a line the bidder typed, and returns false if they want to quit
+func processInput(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return true
+	}
+	name, args := strings.ToLower(fields[0]), fields[1:]
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		showf("Unknown command %q, type \"help\" to see the commands", fields[0])
+		return true
+	}
+	if len(args) < cmd.min || len(args) > cmd.max {
+		show("Usage:", strings.TrimSpace(cmd.name+" "+cmd.args))
+		return true
+	}
+	if cmd.run == nil {
+		return false
+	}
+
+	// every server gets the same request id, so the command can be followed through all of their logs,
+	// and the calls to the servers are traced as children of one span for the command
+	ctx := authContext(logging.WithRequestID(context.Background(), logging.NewRequestID()))
+	ctx, span := tracing.Start(ctx, "command", tracing.Internal, "command", input)
+	ctx = logging.With(ctx, "trace_id", span.TraceID())
+	slog.InfoContext(ctx, "running command", "command", input)
+	err := cmd.run(ctx, args)
+	span.End(err)
+	if err != nil {
+		slog.WarnContext(ctx, "command failed", "command", input, "err", err)
+		show(sentence(status.Convert(err).Message()))
+	}
+	return true
+}
+
+func bid(ctx context.Context, args []string) error {
+	amount, err := parseAmount(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = publish(ctx, chosenAuction(), "bid", amount)
+	return err
+}
+
+func result(ctx context.Context, args []string) error {
+	_, err := publish(ctx, chosenAuction(), "result", -1)
+	return err
+}
+
+func retract(ctx context.Context, args []string) error {
+	_, err := publish(ctx, chosenAuction(), "retract", 0)
+	return err
+}
+
+func history(ctx context.Context, args []string) error {
+	serving := healthyServers()
+	if len(serving) == 0 {
+		return errNoServer
+	}
+	printHistory(ctx, serving)
+	return nil
+}
+
+func listAuctions(ctx context.Context, args []string) error {
+	auctions, err := getAuctions(ctx)
+	if err != nil {
+		return err
+	}
+	printAuctions(auctions)
+	return nil
+}
+
+// prints the auctions, marking the one the client bids in with a *
+func printAuctions(auctions []*gRPC.AuctionInfo) {
+	if len(auctions) == 0 {
+		show("There are no auctions")
+		return
+	}
+	chosen := chosenAuction()
+	for _, a := range auctions {
+		mark := " "
+		if a.Id == chosen {
+			mark = "*"
+		}
+		showf("%s %-16s %-10s %10d  %-12s %s", mark, a.Id, stateName(a.State), a.Amount, a.Bidder, timeLeft(a))
+	}
+}
+
+func join(ctx context.Context, args []string) error {
+	a, err := findAuction(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if ui != nil {
+		ui.choose(a.Id)
+	} else {
+		chooseAuction(a.Id)
+	}
+	showf("Bidding in %s now, the highest bid is %d by %s, %s", a.Id, a.Amount, orNobody(a.Bidder), timeLeft(a))
+	return nil
+}
+
+// watch prints the updates of the auction from now on, until it is turned off
+func watch(ctx context.Context, args []string) error {
+	off := len(args) == 1
+	if off && strings.ToLower(args[0]) != "off" {
+		return fmt.Errorf("usage: watch [off]")
+	}
+	if ui != nil && !off {
+		return fmt.Errorf("the updates of the chosen auction are on the screen already")
+	}
+
+	runningMu.Lock()
+	if stopWatching != nil {
+		stopWatching()
+		stopWatching = nil
+		show("Stopped watching", watching)
+	}
+	runningMu.Unlock()
+	if off {
+		return nil
+	}
+
+	a, err := findAuction(ctx, chosenAuction())
+	if err != nil {
+		return err
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	runningMu.Lock()
+	watching, stopWatching = a.Id, cancel
+	runningMu.Unlock()
+	showf("Watching %s, \"watch off\" stops it", a.Id)
+
+	go func() {
+		err := follow(watchCtx, a.Id, a.LastUpdate, func(update *gRPC.AuctionUpdate) bool {
+			show("[" + a.Id + "] " + describe(update))
+			return true
+		})
+		if err != nil {
+			show("Stopped watching "+a.Id+":", status.Convert(err).Message())
+		}
+	}()
+	return nil
+}
+
+// autobid bids for the bidder whenever someone else has the highest bid, by -autobid-step more than them,
+// until that would be more than the limit or the auction ends
+func autobid(ctx context.Context, args []string) error {
+	off := strings.ToLower(args[0]) == "off"
+	var limit int64
+	if !off {
+		var err error
+		if limit, err = parseAmount(args[0]); err != nil {
+			return err
+		}
+	}
+
+	runningMu.Lock()
+	if stopAutobid != nil {
+		stopAutobid()
+		stopAutobid = nil
+		autobidRounds++
+		show("Stopped the autobid in", autobidding)
+	}
+	runningMu.Unlock()
+	if off {
+		return nil
+	}
+
+	a, err := findAuction(ctx, chosenAuction())
+	if err != nil {
+		return err
+	}
+	if a.State != gRPC.AuctionState_OPEN && a.State != gRPC.AuctionState_PAUSED && a.State != gRPC.AuctionState_SCHEDULED {
+		return fmt.Errorf("%s is %s, it can not be bid in", a.Id, stateName(a.State))
+	}
+	autobidCtx, cancel := context.WithCancel(context.Background())
+	runningMu.Lock()
+	autobidding, autobidMax, stopAutobid = a.Id, limit, cancel
+	autobidRounds++
+	round := autobidRounds
+	runningMu.Unlock()
+	showf("Autobidding in %s up to %d, \"autobid off\" stops it", a.Id, limit)
+
+	go func() {
+		reason := runAutobid(autobidCtx, a, limit)
+		runningMu.Lock()
+		defer runningMu.Unlock()
+		if round != autobidRounds {
+			return // stopped by the bidder
+		}
+		stopAutobid = nil
+		show("Stopped the autobid in "+a.Id+":", reason)
+	}()
+	return nil
+}
+
+// runAutobid bids in the auction until it has to stop, and returns why it stopped
+func runAutobid(ctx context.Context, a *gRPC.AuctionInfo, limit int64) string {
+	highest, bidder, state := a.Amount, a.Bidder, a.State
+	reason := ""
+	// outbid bids if someone else has the highest bid, and returns false if the autobid has to stop
+	outbid := func() bool {
+		if state != gRPC.AuctionState_OPEN || bidder == *clientsName {
+			return true
+		}
+		next := highest + *autobidStep
+		if next < a.Reserve {
+			next = a.Reserve
+		}
+		if next > limit {
+			reason = fmt.Sprintf("%s bid %d, and the next bid would be above your max of %d", bidder, highest, limit)
+			return false
+		}
+		ctx := authContext(logging.WithRequestID(ctx, logging.NewRequestID()))
+		response, err := publish(ctx, a.Id, "bid", next)
+		switch {
+		case err != nil:
+			reason = status.Convert(err).Message()
+			return false
+		case response.Outcome == "accepted":
+			showf("[%s] Autobid bid %d", a.Id, next)
+		case response.Outcome == "too_low":
+			// someone got there first, their bid is in the next update
+		default:
+			reason = fmt.Sprintf("the bid of %d was turned down (%s)", next, response.Outcome)
+			return false
+		}
+		return true
+	}
+
+	if !outbid() {
+		return reason
+	}
+	err := follow(ctx, a.Id, a.LastUpdate, func(update *gRPC.AuctionUpdate) bool {
+		highest, bidder = update.Highest, update.HighestBidder
+		if update.Event != nil {
+			state = update.Event.To
+			switch state {
+			case gRPC.AuctionState_OPEN, gRPC.AuctionState_PAUSED:
+			default:
+				reason = "the auction is " + stateName(state)
+				return false
+			}
+		}
+		return outbid()
+	})
+	if err != nil {
+		return status.Convert(err).Message()
+	}
+	return reason
+}
+
+func printStatus(ctx context.Context, args []string) error {
+	show("Bidder:", *clientsName)
+	current, expires := currentToken()
+	switch {
+	case *password == "":
+		show("Login: none, the servers are trusted with the name")
+	case current == "":
+		show("Login: not logged in")
+	default:
+		show("Login: logged in until", expires.Format("15:04:05"))
+	}
+	show("Auction:", chosenAuction())
+	show("Servers:", serverHealth())
+
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if stopWatching != nil {
+		show("Watching:", watching)
+	} else {
+		show("Watching: no")
+	}
+	if stopAutobid != nil {
+		showf("Autobid: in %s up to %d", autobidding, autobidMax)
+	} else {
+		show("Autobid: off")
+	}
+	return nil
+}
+
+func help(ctx context.Context, args []string) error {
+	show("Commands:")
+	for _, cmd := range commands {
+		showf("  %-20s %s", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.usage)
+	}
+	return nil
+}
+
+// what one server answered to a command
+type published struct {
+	server   int
+	response *gRPC.PublishResponse
+	err      error
+}
+
+// publishAll sends a command to the auction on every server that is SERVING, and returns what each answered
+func publishAll(ctx context.Context, id string, command string, amount int64) []published {
+	defer fanoutSeconds.ObserveSince(time.Now(), command)
+	var answers []published
+	for _, i := range healthyServers() {
+		response, err := servers[i].Publish(ctx, &gRPC.Message{
+			Sender:  *clientsName,
+			Message: command,
+			Bid:     amount,
+			Auction: id,
+		})
+		switch _, limited := rateLimited(err); {
+		case limited:
+			requestsTotal.Inc(command, "rate_limited")
+		case err != nil:
+			requestsTotal.Inc(command, "error")
+			slog.WarnContext(ctx, "something went wrong with the server", "server", i, "err", err)
+		default:
+			requestsTotal.Inc(command, "ok")
+		}
+		answers = append(answers, published{server: i, response: response, err: err})
+	}
+	return answers
+}
+
+// publish sends a command to the auction on every server that is SERVING, and returns the first answer of a
+// server that took it, ex. with the outcome "accepted" or "too_low". The bidder is told the reply on the Join stream.
+func publish(ctx context.Context, id string, command string, amount int64) (*gRPC.PublishResponse, error) {
+	answers := publishAll(ctx, id, command, amount)
+	if len(answers) == 0 {
+		return nil, errNoServer
+	}
+	var retryIn time.Duration // set if a server turned the command down for coming too fast
+	var failed error
+	for _, answer := range answers {
+		if answer.err == nil {
+			return answer.response, nil
+		}
+		if wait, limited := rateLimited(answer.err); limited {
+			retryIn = wait
+		} else {
+			failed = answer.err
+		}
+	}
+	if retryIn > 0 {
+		slog.WarnContext(ctx, "rate limited", "retry_in", retryIn)
+		return nil, status.Errorf(codes.ResourceExhausted, "you are sending too fast, try again in %v", retryIn.Round(100*time.Millisecond))
+	}
+	return nil, status.Errorf(status.Code(failed), "the servers turned the %s down: %s", command, status.Convert(failed).Message())
+}
+
+// the auctions from the first server that answers
+func getAuctions(ctx context.Context) ([]*gRPC.AuctionInfo, error) {
+	serving := healthyServers()
+	if len(serving) == 0 {
+		return nil, errNoServer
+	}
+	var err error
+	for _, i := range serving {
+		var response *gRPC.ListAuctionsResponse
+		if response, err = servers[i].ListAuctions(ctx, &gRPC.ListAuctionsRequest{}); err == nil {
+			return response.Auctions, nil
+		}
+		slog.WarnContext(ctx, "could not list the auctions", "server", i, "err", err)
+	}
+	return nil, status.Errorf(status.Code(err), "could not list the auctions: %s", status.Convert(err).Message())
+}
+
+func findAuction(ctx context.Context, id string) (*gRPC.AuctionInfo, error) {
+	auctions, err := getAuctions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range auctions {
+		if a.Id == id {
+			return a, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "there is no auction %q, \"auctions\" lists them", id)
+}
+
+// parseAmount reads the amount of a bid, which has to be a whole number above 0
+func parseAmount(text string) (int64, error) {
+	amount, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an amount, amounts are whole numbers, ex. 150", text)
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("the amount has to be above 0")
+	}
+	return amount, nil
+}
+
+// an error as a sentence for the bidder, ex. "No server is available"
+func sentence(text string) string {
+	for i, r := range text {
+		return string(unicode.ToUpper(r)) + text[i+len(string(r)):]
+	}
+	return text
+}
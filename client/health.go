@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// the health service name the servers report if they take bids
+const auctionService = "proto.AuctionSystem"
+
+// which servers are SERVING, only those are sent commands and counted for answers
+var healthy = make([]bool, 3)
+var healthMu sync.Mutex
+
+// watches the health of server i, and joins it every time it becomes SERVING,
+// so the client gets back a server that was restarted
+func watchServer(i int, joinRequest *gRPC.JoinRequest) {
+	client := healthpb.NewHealthClient(serverConns[i])
+	for {
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: auctionService})
+		for err == nil {
+			var response *healthpb.HealthCheckResponse
+			response, err = stream.Recv()
+			if err == nil {
+				if setHealthy(i, response.Status == healthpb.HealthCheckResponse_SERVING) {
+					joinServer(i, joinRequest)
+				}
+			}
+		}
+		setHealthy(i, false)
+		time.Sleep(time.Second)
+	}
+}
+
+// records the health of server i and returns true if it just became SERVING
+func setHealthy(i int, up bool) bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if healthy[i] == up {
+		return false
+	}
+	healthy[i] = up
+	slog.Info("server health changed", "server", i, "serving", up)
+
+	numberOfServers = 0
+	for _, up := range healthy {
+		if up {
+			numberOfServers++
+		}
+	}
+	serversAvailable.Set(float64(numberOfServers))
+	return up
+}
+
+// checkHealth asks every server at once whether it is SERVING, for one-shot commands, which do not watch them
+func checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range serverConns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := healthpb.NewHealthClient(serverConns[i]).Check(ctx, &healthpb.HealthCheckRequest{Service: auctionService})
+			if err != nil {
+				slog.DebugContext(ctx, "health check failed", "server", i, "err", err)
+			}
+			setHealthy(i, err == nil && response.Status == healthpb.HealthCheckResponse_SERVING)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// how many servers are SERVING right now
+func servingCount() int {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return numberOfServers
+}
+
+// the servers that are SERVING right now
+func healthyServers() []int {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	var serving []int
+	for i, up := range healthy {
+		if up {
+			serving = append(serving, i)
+		}
+	}
+	return serving
+}
+
+func joinServer(i int, joinRequest *gRPC.JoinRequest) {
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	slog.InfoContext(ctx, "joining the auction", "server", i)
+	stream, err := servers[i].Join(authContext(ctx), joinRequest)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to join", "server", i, "err", err)
+		return
+	}
+	go awaitResponse(stream)
+}
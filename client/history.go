@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/status"
+)
+
+// printHistory prints every accepted bid of the auction
+func printHistory(ctx context.Context, serving []int) {
+	bids, err := getHistory(ctx, serving, chosenAuction())
+	if err != nil {
+		show("Could not get the bid history:", status.Convert(err).Message())
+		return
+	}
+	printBids(bids)
+}
+
+func printBids(bids []*gRPC.Bid) {
+	if len(bids) == 0 {
+		show("There are no bids yet")
+		return
+	}
+	for _, bid := range bids {
+		retracted := ""
+		if bid.Retracted {
+			retracted = " (retracted)"
+		}
+		showf("#%d %s %s bid %d%s\n", bid.Sequence, time.UnixMilli(bid.At).Format("15:04:05"), bid.Bidder, bid.Amount, retracted)
+	}
+}
+
+// getHistory gets every accepted bid of the auction. The servers number the bids the same, so when
+// one fails in the middle the next page is asked for from another.
+func getHistory(ctx context.Context, serving []int, id string) ([]*gRPC.Bid, error) {
+	var bids []*gRPC.Bid
+	token := ""
+	for {
+		var response *gRPC.BidHistoryResponse
+		var err error
+		for _, i := range serving {
+			response, err = servers[i].GetBidHistory(ctx, &gRPC.BidHistoryRequest{AuctionId: id, PageToken: token})
+			if err == nil {
+				break
+			}
+			slog.WarnContext(ctx, "could not get the bid history", "server", i, "err", err)
+		}
+		if err != nil {
+			requestsTotal.Inc("history", "error")
+			return nil, err
+		}
+		bids = append(bids, response.Bids...)
+		if response.NextPageToken == "" {
+			break
+		}
+		token = response.NextPageToken
+	}
+	requestsTotal.Inc("history", "ok")
+	return bids, nil
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/mbjnitu/AuctionSystem-replication/metrics"
+)
+
+// everything the client exports on /metrics when started with -metrics
+var registry = metrics.NewRegistry()
+
+var requestsTotal = registry.Counter("auction_client_requests_total", "Calls made to a server, by command and outcome.", "command", "outcome")
+var fanoutSeconds = registry.Histogram("auction_client_fanout_seconds", "Time taken to send a command to every server.", metrics.DefaultBuckets, "command")
+var serversAvailable = registry.Gauge("auction_client_servers", "Servers the client still counts on for answers.")
+var messagesTotal = registry.Counter("auction_client_messages_total", "Messages shown to the bidder after the servers agreed on them.")
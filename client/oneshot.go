@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Given a command after its flags, ex.
+// client -name alice bid -auction car -amount 100 -json
+// the client does that one thing against the cluster, prints the result and exits with one of the codes below,
+// so it can be used from scripts. It does not join the auction, so the other bidders do not see it come and go.
+
+// the exit codes of a one-shot command
+const (
+	exitOK          = 0 // done, ex. the bid was accepted
+	exitTurnedDown  = 1 // the servers took the command but said no, ex. the bid was too low
+	exitUsage       = 2 // the command or its arguments are wrong
+	exitUnavailable = 3 // no server could be reached in time, or none of them is SERVING
+	exitFailed      = 4 // the servers failed the command, ex. the auction does not exist or the login is wrong
+)
+
+var oneShotCommands = map[string]string{
+	"bid":      "[-amount] amount - bid in the auction",
+	"result":   "- ask for the highest bid, or who won",
+	"retract":  "- take back your bid if it is the highest bid",
+	"history":  "- list every accepted bid of the auction",
+	"auctions": "- list the auctions",
+}
+
+// the outcomes each one-shot command exits with exitOK on, the others are exitTurnedDown.
+// A result is done whether the auction is still open or over, then the servers answer with who won.
+var doneOutcomes = map[string]map[string]bool{
+	"bid":     {"accepted": true},
+	"retract": {"retracted": true},
+	"result":  {"result": true, "auction_over": true},
+}
+
+var jsonOptions = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// marshalJSON is the message as json with every field, ex. "bid": "0", except the messages that are not set,
+// ex. the event of a reply that is not about the auction changing state, which protojson would print as null
+func marshalJSON(message proto.Message) (json.RawMessage, error) {
+	data, err := jsonOptions.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(dropNulls(v))
+}
+
+// dropNulls removes the fields that are null from the json objects in v
+func dropNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+			} else {
+				v[key] = dropNulls(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = dropNulls(value)
+		}
+	}
+	return v
+}
+
+type oneShotCommand struct {
+	name    string
+	amount  int64
+	json    bool
+	timeout time.Duration
+}
+
+// the command given after the flags, if any
+var oneShot *oneShotCommand
+
+// parseOneShot reads the command and its arguments. The flags of the client, ex. -auction, may come after the
+// command as well.
+func parseOneShot(args []string) (*oneShotCommand, error) {
+	name := args[0]
+	if _, ok := oneShotCommands[name]; !ok {
+		oneShotUsage()
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	fs := flag.NewFlagSet("client "+name, flag.ContinueOnError)
+	flag.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	amount := fs.String("amount", "", "the amount to bid")
+	asJSON := fs.Bool("json", false, "print the result as json")
+	timeout := fs.Duration("timeout", 5*time.Second, "how long to wait for the servers")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: client [flags] %s %s\n", name, oneShotCommands[name])
+		fs.PrintDefaults()
+	}
+
+	var positional []string
+	args = args[1:]
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	c := &oneShotCommand{name: name, json: *asJSON, timeout: *timeout}
+	if name == "bid" {
+		if *amount == "" && len(positional) == 1 {
+			*amount, positional = positional[0], nil
+		}
+		if *amount == "" {
+			return nil, errors.New("bid needs an amount, ex. client bid -amount 100")
+		}
+		var err error
+		if c.amount, err = parseAmount(*amount); err != nil {
+			return nil, err
+		}
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("%s does not take %q", name, positional[0])
+	}
+	return c, nil
+}
+
+func oneShotUsage() {
+	names := make([]string, 0, len(oneShotCommands))
+	for name := range oneShotCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: client [flags] [command] [-json] [-timeout 5s]")
+	fmt.Fprintln(os.Stderr, "without a command the client joins the auction and bids interactively, the commands do one thing and exit:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, oneShotCommands[name])
+	}
+}
+
+// run runs the command against the servers and returns the exit code
+func (c *oneShotCommand) run() int {
+	ctx, cancel := context.WithTimeout(logging.WithRequestID(context.Background(), logging.NewRequestID()), c.timeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "command", tracing.Internal, "command", c.name)
+	ctx = logging.With(ctx, "trace_id", span.TraceID())
+	slog.InfoContext(ctx, "running one-shot command", "command", c.name, "auction", chosenAuction())
+
+	code, err := c.call(ctx)
+	span.End(err)
+	if err != nil {
+		slog.WarnContext(ctx, "one-shot command failed", "command", c.name, "err", err)
+		return c.fail(err)
+	}
+	return code
+}
+
+func (c *oneShotCommand) call(ctx context.Context) (int, error) {
+	if *password != "" {
+		if err := login(); err != nil {
+			return 0, err
+		}
+	}
+	ctx = authContext(ctx)
+	checkHealth(ctx)
+	serving := healthyServers()
+	if len(serving) == 0 {
+		return 0, errNoServer
+	}
+
+	switch c.name {
+	case "history":
+		bids, err := getHistory(ctx, serving, chosenAuction())
+		if err != nil {
+			return 0, err
+		}
+		return exitOK, c.print(&gRPC.BidHistoryResponse{Bids: bids}, func() { printBids(bids) })
+	case "auctions":
+		auctions, err := getAuctions(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return exitOK, c.print(&gRPC.ListAuctionsResponse{Auctions: auctions}, func() { printAuctions(auctions) })
+	}
+
+	amount := map[string]int64{"bid": c.amount, "result": -1}[c.name]
+	answers := publishAll(ctx, chosenAuction(), c.name, amount)
+	var response *gRPC.PublishResponse
+	var failed error
+	for _, answer := range answers {
+		if answer.err == nil && response == nil {
+			response = answer.response
+		} else if answer.err != nil {
+			failed = answer.err
+		}
+	}
+	if response == nil {
+		return 0, failed
+	}
+	code := exitCode(c.name, response.Outcome)
+
+	if !c.json {
+		if response.Reply != nil && response.Reply.Bid > 0 {
+			fmt.Println(response.Reply.Message + strconv.FormatInt(response.Reply.Bid, 10))
+		} else if response.Reply != nil {
+			fmt.Println(response.Reply.Message)
+		}
+		return code, nil
+	}
+
+	// what every server answered, so a script can see if one of them is behind
+	type serverAnswer struct {
+		Server  string `json:"server"`
+		OK      bool   `json:"ok"`
+		Outcome string `json:"outcome,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+	out := struct {
+		Command string          `json:"command"`
+		Auction string          `json:"auction"`
+		Bidder  string          `json:"bidder"`
+		Amount  int64           `json:"amount,omitempty"`
+		OK      bool            `json:"ok"`
+		Outcome string          `json:"outcome"`
+		Reply   json.RawMessage `json:"reply,omitempty"`
+		Servers []serverAnswer  `json:"servers"`
+	}{Command: c.name, Auction: chosenAuction(), Bidder: *clientsName, Amount: c.amount, OK: code == exitOK, Outcome: response.Outcome}
+	if response.Reply != nil {
+		out.Reply, _ = marshalJSON(response.Reply)
+	}
+	for _, answer := range answers {
+		a := serverAnswer{Server: serverConns[answer.server].Target(), OK: answer.err == nil}
+		if answer.err != nil {
+			a.Error = status.Code(answer.err).String() + ": " + status.Convert(answer.err).Message()
+		} else {
+			a.Outcome = answer.response.Outcome
+		}
+		out.Servers = append(out.Servers, a)
+	}
+	return code, printJSON(out)
+}
+
+// print prints message as json with -json, else with text
+func (c *oneShotCommand) print(message proto.Message, text func()) error {
+	if !c.json {
+		text()
+		return nil
+	}
+	data, err := marshalJSON(message)
+	if err != nil {
+		return err
+	}
+	return printJSON(data)
+}
+
+// fail prints why the command failed, as json on stdout with -json so a script gets json either way, and
+// returns the exit code for it
+func (c *oneShotCommand) fail(err error) int {
+	st := status.Convert(err)
+	code := errorExitCode(err)
+	if c.json {
+		printJSON(struct {
+			Command string `json:"command"`
+			OK      bool   `json:"ok"`
+			Code    string `json:"code"`
+			Error   string `json:"error"`
+		}{c.name, false, st.Code().String(), st.Message()})
+	} else {
+		fmt.Fprintln(os.Stderr, "client:", st.Message())
+	}
+	return code
+}
+
+// the exit code for the outcome the servers answered command with
+func exitCode(command, outcome string) int {
+	if doneOutcomes[command][outcome] {
+		return exitOK
+	}
+	return exitTurnedDown
+}
+
+// the exit code for a command that failed with err
+func errorExitCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitUnavailable
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return exitUnavailable
+	}
+	return exitFailed
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
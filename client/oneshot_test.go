@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		command string
+		outcome string
+		want    int
+	}{
+		{"bid", "accepted", exitOK},
+		{"bid", "too_low", exitTurnedDown},
+		{"bid", "below_reserve", exitTurnedDown},
+		{"bid", "auction_over", exitTurnedDown},
+		{"bid", "auction_paused", exitTurnedDown},
+		{"retract", "retracted", exitOK},
+		{"retract", "too_late", exitTurnedDown},
+		{"retract", "auction_over", exitTurnedDown},
+		{"result", "result", exitOK},
+		{"result", "auction_over", exitOK},
+		{"result", "auction_not_open", exitTurnedDown},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.command, test.outcome); got != test.want {
+			t.Errorf("exitCode(%q, %q) = %d, want %d", test.command, test.outcome, got, test.want)
+		}
+	}
+}
+
+func TestErrorExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errNoServer, exitUnavailable},
+		{status.Error(codes.Unavailable, "connection refused"), exitUnavailable},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), exitUnavailable},
+		{context.DeadlineExceeded, exitUnavailable},
+		{status.Error(codes.NotFound, "no auction car"), exitFailed},
+		{status.Error(codes.Unauthenticated, "wrong password"), exitFailed},
+		{status.Error(codes.PermissionDenied, "banned"), exitFailed},
+		{errors.New("something else"), exitFailed},
+	}
+	for _, test := range tests {
+		if got := errorExitCode(test.err); got != test.want {
+			t.Errorf("errorExitCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestParseOneShot(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int64
+		wantErr bool
+	}{
+		{"amount flag", []string{"bid", "-amount", "100"}, 100, false},
+		{"amount on its own", []string{"bid", "100"}, 100, false},
+		{"no amount", []string{"bid"}, 0, true},
+		{"bad amount", []string{"bid", "lots"}, 0, true},
+		{"unknown command", []string{"buy", "100"}, 0, true},
+		{"extra argument", []string{"result", "now"}, 0, true},
+		{"result", []string{"result", "-json"}, 0, false},
+	}
+	for _, test := range tests {
+		c, err := parseOneShot(test.args)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, want an error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && c.amount != test.want {
+			t.Errorf("%s: amount = %d, want %d", test.name, c.amount, test.want)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		message proto.Message
+		want    []string // fields that must be there
+		notWant []string // fields that must be left out
+	}{
+		{"reply without an event", &gRPC.Message{Sender: "Server", Message: "Bid accepted"}, []string{"sender", "bid", "auction"}, []string{"event"}},
+		{"reply with an event", &gRPC.Message{Sender: "Server", Event: &gRPC.AuctionEvent{Auction: "car"}}, []string{"event"}, nil},
+		{"auction without an order", &gRPC.AuctionInfo{Id: "car"}, []string{"id", "amount", "history"}, []string{"order"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := marshalJSON(test.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range test.want {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("%s is missing: %s", name, data)
+				}
+			}
+			for _, name := range test.notWant {
+				if _, ok := fields[name]; ok {
+					t.Errorf("%s should be left out: %s", name, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+
+package main
+
+import "errors"
+
+// the full-screen UI is not supported here, the client always uses the line mode
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(in int, out int) (func(), error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// isTerminal reports if the file descriptor is a console
+func isTerminal(fd int) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// makeRaw hands every key press to the client as it is typed, without echoing it, and turns on the escape
+// sequences the full-screen UI draws with. It returns a function that puts the console back the way it was.
+func makeRaw(in int, out int) (func(), error) {
+	var inMode, outMode uint32
+	if err := windows.GetConsoleMode(windows.Handle(in), &inMode); err != nil {
+		return nil, err
+	}
+	if err := windows.GetConsoleMode(windows.Handle(out), &outMode); err != nil {
+		return nil, err
+	}
+	raw := inMode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT)
+	if err := windows.SetConsoleMode(windows.Handle(in), raw|windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(windows.Handle(out), outMode|windows.ENABLE_PROCESSED_OUTPUT|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		windows.SetConsoleMode(windows.Handle(in), inMode)
+		return nil, err
+	}
+	return func() {
+		windows.SetConsoleMode(windows.Handle(in), inMode)
+		windows.SetConsoleMode(windows.Handle(out), outMode)
+	}, nil
+}
+
+// terminalSize returns the columns and rows of the console window
+func terminalSize(fd int) (int, int, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, nil
+}
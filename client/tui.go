@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/status"
+)
+
+// The full-screen UI, used when the client runs in a terminal. It shows the auctions, the chosen one with its
+// price, countdown and updates, what the servers said and which servers are up, and bids with key presses.
+// It is drawn with ANSI escape sequences, which Windows 10 and later consoles understand as well.
+
+const maxMessages = 100 // what the servers said, kept for the messages pane
+const maxUpdates = 200  // updates of the chosen auction, kept for the updates pane
+
+type tui struct {
+	mu       sync.Mutex
+	auctions []*gRPC.AuctionInfo
+	chosen   string                // the auction bids go to, the same as *auctionID
+	updates  []*gRPC.AuctionUpdate // of the chosen auction, oldest first
+	messages []string              // oldest first
+	typing   string                // "bid" while the bidder types the amount of a bid, "command" while they type a command
+	text     string                // what they typed
+	closed   bool
+
+	redraw    chan struct{}
+	stopWatch context.CancelFunc
+}
+
+// the UI when it is on, show sends what the client prints to it
+var ui *tui
+
+// useTUI reports if the full-screen UI should be used, which is the default when the client runs in a terminal
+func useTUI() bool {
+	switch *uiMode {
+	case "line":
+		return false
+	case "tui":
+		return true
+	}
+	return isTerminal(int(os.Stdin.Fd())) && isTerminal(int(os.Stdout.Fd()))
+}
+
+// runTUI shows the full-screen UI until the bidder quits. It returns an error if the terminal can not be used.
+func runTUI() error {
+	restore, err := makeRaw(int(os.Stdin.Fd()), int(os.Stdout.Fd()))
+	if err != nil {
+		return err
+	}
+	t := &tui{redraw: make(chan struct{}, 1)}
+	// the alternate screen, so the terminal is left as it was, without the cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	ui = t
+
+	t.choose(chosenAuction())
+	go t.refreshAuctions()
+	go t.drawAll()
+	t.readKeys()
+
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	restore()
+	return nil
+}
+
+// changed asks for the screen to be drawn again
+func (t *tui) changed() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// message adds a line to the messages pane
+func (t *tui) message(text string) {
+	t.mu.Lock()
+	t.messages = append(t.messages, time.Now().Format("15:04:05")+" "+text)
+	if len(t.messages) > maxMessages {
+		t.messages = t.messages[len(t.messages)-maxMessages:]
+	}
+	t.mu.Unlock()
+	t.changed()
+}
+
+// choose makes id the auction that is shown and bid in
+func (t *tui) choose(id string) {
+	chooseAuction(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	if t.stopWatch != nil {
+		t.stopWatch()
+	}
+	t.stopWatch = cancel
+	t.chosen = id
+	t.updates = nil
+	t.mu.Unlock()
+	t.changed()
+	go t.follow(ctx, id)
+}
+
+// refreshAuctions gets the auctions from the first server that answers, once a second
+func (t *tui) refreshAuctions() {
+	for {
+		for _, i := range healthyServers() {
+			ctx, cancel := context.WithTimeout(authContext(context.Background()), 2*time.Second)
+			response, err := servers[i].ListAuctions(ctx, &gRPC.ListAuctionsRequest{})
+			cancel()
+			if err != nil {
+				slog.Debug("could not list the auctions", "server", i, "err", err)
+				continue
+			}
+			t.mu.Lock()
+			t.auctions = response.Auctions
+			t.mu.Unlock()
+			t.changed()
+			break
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// follow keeps the updates of the auction
+func (t *tui) follow(ctx context.Context, id string) {
+	err := follow(ctx, id, 0, func(update *gRPC.AuctionUpdate) bool {
+		t.addUpdate(id, update)
+		return true
+	})
+	if err != nil {
+		t.message("Could not follow " + id + ": " + status.Convert(err).Message())
+	}
+}
+
+func (t *tui) addUpdate(id string, update *gRPC.AuctionUpdate) {
+	t.mu.Lock()
+	if t.chosen == id {
+		t.updates = append(t.updates, update)
+		if len(t.updates) > maxUpdates {
+			t.updates = t.updates[len(t.updates)-maxUpdates:]
+		}
+	}
+	t.mu.Unlock()
+	t.changed()
+}
+
+// readKeys acts on the keys the bidder presses until they quit
+func (t *tui) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			slog.Warn("failed to read input", "err", err)
+			return
+		}
+		if !t.key(string(buf[:n])) {
+			return
+		}
+	}
+}
+
+// key acts on a key press, and returns false if the bidder wants to quit
+func (t *tui) key(key string) bool {
+	if key == "\x03" { // ctrl+c
+		return false
+	}
+	t.mu.Lock()
+	typing := t.typing
+	t.mu.Unlock()
+
+	if typing != "" {
+		t.mu.Lock()
+		var send string
+		switch {
+		case key == "\x7f" || key == "\b":
+			if t.text != "" {
+				_, size := utf8.DecodeLastRuneInString(t.text)
+				t.text = t.text[:len(t.text)-size]
+			}
+		case key == "\r" || key == "\n":
+			t.typing, send = "", t.text
+		case key == "\x1b":
+			t.typing = ""
+		case typing == "bid" && strings.Trim(key, "0123456789") == "":
+			t.text += key
+		case typing == "command" && strings.IndexFunc(key, unicode.IsControl) < 0:
+			t.text += key
+		}
+		t.mu.Unlock()
+		t.changed()
+		if send == "" {
+			return true
+		}
+		if typing == "bid" {
+			send = "bid " + send
+		}
+		return processInput(send)
+	}
+
+	switch key {
+	case "q":
+		return false
+	case "b", ":":
+		t.mu.Lock()
+		t.typing, t.text = "bid", ""
+		if key == ":" {
+			t.typing = "command"
+		}
+		t.mu.Unlock()
+		t.changed()
+	case "r":
+		processInput("retract")
+	case "h":
+		processInput("history")
+	case "\x1b[A", "k":
+		t.move(-1)
+	case "\x1b[B", "j":
+		t.move(1)
+	}
+	return true
+}
+
+// move chooses the auction above or below the chosen one
+func (t *tui) move(by int) {
+	t.mu.Lock()
+	next := ""
+	for i, a := range t.auctions {
+		if a.Id == t.chosen && i+by >= 0 && i+by < len(t.auctions) {
+			next = t.auctions[i+by].Id
+		}
+	}
+	if next == "" && len(t.auctions) > 0 && by > 0 && !t.listed(t.chosen) {
+		next = t.auctions[0].Id
+	}
+	t.mu.Unlock()
+	if next != "" {
+		t.choose(next)
+	}
+}
+
+// reports if the auction is in the list. Must be called holding t.mu.
+func (t *tui) listed(id string) bool {
+	for _, a := range t.auctions {
+		if a.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// drawAll draws the screen whenever something changed, and every quarter of a second for the countdown
+func (t *tui) drawAll() {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.redraw:
+		}
+		t.draw()
+	}
+}
+
+func (t *tui) draw() {
+	width, height, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		width, height = 80, 24
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	var lines []string
+	highlight := -1 // the line of the chosen auction
+	add := func(format string, a ...any) { lines = append(lines, fmt.Sprintf(format, a...)) }
+
+	add(" Auction - %s%s", *clientsName, alignRight("servers: "+serverHealth(), width-len(" Auction - "+*clientsName)-1))
+	add("")
+	add(" Auctions")
+	var chosen *gRPC.AuctionInfo
+	shown := t.auctions
+	if room := height / 4; len(shown) > room {
+		shown = shown[:room]
+	}
+	for _, a := range shown {
+		if a.Id == t.chosen {
+			highlight, chosen = len(lines), a
+		}
+		add("   %-16s %-10s %10d  %-12s %s", a.Id, stateName(a.State), a.Amount, a.Bidder, timeLeft(a))
+	}
+	if len(t.auctions) == 0 {
+		add("   no auctions yet")
+	}
+	add("")
+	if chosen == nil {
+		for _, a := range t.auctions {
+			if a.Id == t.chosen {
+				chosen = a
+			}
+		}
+	}
+	if chosen != nil {
+		add(" %s: highest bid %d by %s, reserve %d, %s", chosen.Id, chosen.Amount, orNobody(chosen.Bidder), chosen.Reserve, timeLeft(chosen))
+	} else {
+		add(" %s: waiting for the servers", t.chosen)
+	}
+	add("")
+
+	// what is left is shared by the updates and the messages
+	rest := height - len(lines) - 6
+	add(" Updates")
+	for _, update := range last(t.updates, rest/2) {
+		add("   %s", describe(update))
+	}
+	add("")
+	add(" Messages")
+	for _, message := range last(t.messages, rest-rest/2) {
+		add("   %s", message)
+	}
+	for len(lines) < height-2 {
+		add("")
+	}
+	add("")
+	switch t.typing {
+	case "bid":
+		add(" Bid in %s: %s_   (enter to bid, esc to cancel)", t.chosen, t.text)
+	case "command":
+		add(" :%s_   (enter to run, esc to cancel, help lists the commands)", t.text)
+	default:
+		add(" [b] bid  [r] retract  [h] history  [:] command  [up/down] choose auction  [q] quit")
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for i, line := range lines[:min(len(lines), height)] {
+		line = fit(line, width)
+		if i == highlight {
+			line = "\x1b[7m >" + line[min(2, len(line)):] + "\x1b[0m"
+		}
+		screen.WriteString(line + "\x1b[K")
+		if i < height-1 {
+			screen.WriteString("\r\n")
+		}
+	}
+	screen.WriteString("\x1b[J")
+	os.Stdout.WriteString(screen.String())
+}
+
+// the last n of list
+func last[T any](list []T, n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	if len(list) > n {
+		return list[len(list)-n:]
+	}
+	return list
+}
+
+// cuts line to the width of the screen
+func fit(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width])
+}
+
+func alignRight(text string, width int) string {
+	if width <= len(text) {
+		return " " + text
+	}
+	return strings.Repeat(" ", width-len(text)) + text
+}
+
+func serverHealth() string {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	var parts []string
+	for i, up := range healthy {
+		name := strconv.Itoa(i)
+		if i < len(serverConns) {
+			name = serverConns[i].Target()
+		}
+		if up {
+			parts = append(parts, name+" up")
+		} else {
+			parts = append(parts, name+" down")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func stateName(state gRPC.AuctionState) string {
+	return strings.ToLower(state.String())
+}
+
+func orNobody(name string) string {
+	if name == "" {
+		return "nobody"
+	}
+	return name
+}
+
+// timeLeft says when the auction opens or ends, or how it ended
+func timeLeft(a *gRPC.AuctionInfo) string {
+	switch a.State {
+	case gRPC.AuctionState_SCHEDULED:
+		return "opens in " + clock(time.Until(time.UnixMilli(a.StartsAt)))
+	case gRPC.AuctionState_OPEN:
+		return "ends in " + clock(time.Until(time.UnixMilli(a.EndsAt)))
+	case gRPC.AuctionState_PAUSED:
+		if a.RemainingMs == 0 {
+			return "paused"
+		}
+		return "paused with " + clock(time.Duration(a.RemainingMs)*time.Millisecond) + " left"
+	case gRPC.AuctionState_CLOSING:
+		return "closing"
+	case gRPC.AuctionState_CLOSED, gRPC.AuctionState_SETTLED:
+		if a.Bidder == "" {
+			return "ended without bids"
+		}
+		return "won by " + a.Bidder
+	case gRPC.AuctionState_CANCELLED:
+		return "cancelled"
+	}
+	return ""
+}
+
+// ex. 02:31, or 1:02:31 from an hour up
+func clock(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+// describe is a line for an update, ex. "#3 12:00:01 alice bid 150"
+func describe(update *gRPC.AuctionUpdate) string {
+	at := time.UnixMilli(update.At).Format("15:04:05")
+	switch {
+	case update.Type == "bid.accepted":
+		return fmt.Sprintf("#%d %s %s bid %d", update.Sequence, at, update.Bidder, update.Amount)
+	case update.Type == "bid.retracted":
+		return fmt.Sprintf("#%d %s %s retracted %d, the highest bid is %d", update.Sequence, at, update.Bidder, update.Amount, update.Highest)
+	case update.Event != nil:
+		text := fmt.Sprintf("#%d %s %s", update.Sequence, at, stateName(update.Event.To))
+		if update.Event.Reason != "" {
+			text += " (" + update.Event.Reason + ")"
+		}
+		return text
+	}
+	return fmt.Sprintf("#%d %s %s", update.Sequence, at, update.Type)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// follow calls fn with every update of the auction after the given one, going on from the last one with another
+// server when one goes away. It returns when fn returns false, ctx is done or a server turns the watch down.
+func follow(ctx context.Context, id string, after uint64, fn func(*gRPC.AuctionUpdate) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for {
+		for _, i := range healthyServers() {
+			stream, err := servers[i].Watch(authContext(ctx), &gRPC.WatchRequest{AuctionId: id, AfterSequence: after})
+			for err == nil {
+				var update *gRPC.AuctionUpdate
+				if update, err = stream.Recv(); err == nil {
+					after = update.Sequence
+					if !fn(update) {
+						return nil
+					}
+				}
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			if status.Code(err) != codes.Unavailable {
+				return err
+			}
+			slog.Info("lost the server the auction was followed on", "server", i, "auction", id, "after", after)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
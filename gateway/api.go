@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// a call of the API, the spec in openapi.go is made from these as well
+type route struct {
+	method   string
+	path     string // "{id}" stands for the id of an auction
+	summary  string
+	admin    bool          // only for operators, see checkAdmin
+	query    []queryParam  // the query parameters it takes
+	body     proto.Message // the body it takes, nil for none
+	bodyName string        // the schema of a body that is not a proto message, see handSchemas
+	response proto.Message // what it answers with
+	status   int
+	handle   func(ctx context.Context, r *http.Request, id string) (proto.Message, error)
+	// instead of handle, for calls that answer with a stream of server-sent events of response.
+	// It returns an error only if it has not written anything yet.
+	stream func(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) error
+}
+
+type queryParam struct {
+	name        string
+	kind        string // an OpenAPI type, ex. "string" or "integer"
+	description string
+}
+
+var routes = []route{
+	{
+		method: http.MethodPost, path: "/v1/login", summary: "Log in as a registered bidder, the token goes in the Authorization header as \"Bearer [token]\"",
+		body: &gRPC.LoginRequest{}, response: &gRPC.LoginResponse{}, status: http.StatusOK, handle: login,
+	},
+	{
+		method: http.MethodGet, path: "/v1/auctions", summary: "List the auctions, but the drafts",
+		response: &gRPC.ListAuctionsResponse{}, status: http.StatusOK, handle: listAuctions,
+	},
+	{
+		method: http.MethodPost, path: "/v1/auctions", summary: "Create an auction on every replica, with a random id if none is given", admin: true,
+		body: &gRPC.CreateAuctionRequest{}, response: &gRPC.AuctionInfo{}, status: http.StatusCreated, handle: createAuction,
+	},
+	{
+		method: http.MethodPost, path: "/v1/auctions/{id}/bids", summary: "Bid in the auction, the bid is sent to every replica",
+		bodyName: "BidRequest", response: &gRPC.PublishResponse{}, status: http.StatusOK, handle: placeBid,
+	},
+	{
+		method: http.MethodGet, path: "/v1/auctions/{id}/bids", summary: "The accepted bids of the auction, oldest first",
+		query: []queryParam{
+			{"page_token", "string", "next_page_token of the previous page, empty for the first"},
+			{"page_size", "integer", "0 for 50, at most 500"},
+			{"anonymize", "boolean", "replace the names of the bidders with \"bidder 1\", \"bidder 2\", ..."},
+		},
+		response: &gRPC.BidHistoryResponse{}, status: http.StatusOK, handle: bidHistory,
+	},
+	{
+		method: http.MethodGet, path: "/v1/auctions/{id}/result", summary: "The highest bid of the auction so far, or who won it",
+		query:    []queryParam{{"bidder", "string", "the bidder asking, required"}},
+		response: &gRPC.PublishResponse{}, status: http.StatusOK, handle: result,
+	},
+	{
+		method: http.MethodGet, path: "/v1/auctions/{id}/events", summary: "Every bid, retraction and change of state of the auction as server-sent events, then the new ones as they happen",
+		query: []queryParam{
+			{"after", "integer", "the sequence of the last update the caller has, the Last-Event-ID header takes its place when a browser reconnects"},
+			{"access_token", "string", "the login token, for browsers that can not send the Authorization header"},
+		},
+		response: &gRPC.AuctionUpdate{}, status: http.StatusOK, stream: watchEvents,
+	},
+}
+
+// match finds the route for a request, and the id of the auction in its path. If only the method is wrong,
+// the methods the path does take are returned instead.
+func match(method string, path string) (*route, string, []string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var allowed []string
+	for i := range routes {
+		rt := &routes[i]
+		pattern := strings.Split(strings.Trim(rt.path, "/"), "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		id, ok := "", true
+		for j, part := range pattern {
+			switch {
+			case part == "{id}" && segments[j] != "":
+				id = segments[j]
+			case part != segments[j]:
+				ok = false
+			}
+		}
+		if !ok {
+			continue
+		}
+		if rt.method != method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		return rt, id, nil
+	}
+	return nil, "", allowed
+}
+
+// reads the json body of the request into message
+func readBody(r *http.Request, message proto.Message) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "could not read the body: %v", err)
+	}
+	if err := unmarshal.Unmarshal(data, message); err != nil {
+		return status.Errorf(codes.InvalidArgument, "the body is not valid: %v", err)
+	}
+	return nil
+}
+
+func login(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	request := &gRPC.LoginRequest{}
+	if err := readBody(r, request); err != nil {
+		return nil, err
+	}
+	// the servers share the signing key, so one token works for all of them
+	return first(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.Login(ctx, request)
+	})
+}
+
+func listAuctions(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	return first(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.ListAuctions(ctx, &gRPC.ListAuctionsRequest{})
+	})
+}
+
+func createAuction(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	request := &gRPC.CreateAuctionRequest{}
+	if err := readBody(r, request); err != nil {
+		return nil, err
+	}
+	// every replica has to get the same id, so a missing one is made up here and not by the servers
+	if request.Id == "" {
+		b := make([]byte, 4)
+		rand.Read(b)
+		request.Id = "auction-" + hex.EncodeToString(b)
+	}
+	return fanOut(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.admin.CreateAuction(ctx, request)
+	})
+}
+
+// the body of a bid, ex. {"bidder": "alice", "amount": 100}
+type bidBody struct {
+	Bidder string `json:"bidder"`
+	Amount int64  `json:"amount"`
+}
+
+func placeBid(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	var body bidBody
+	decoder := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "the body is not valid: %v", err)
+	}
+	if body.Bidder == "" {
+		return nil, status.Error(codes.InvalidArgument, "the bidder is missing")
+	}
+	if body.Amount <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "the amount has to be above 0")
+	}
+	message := &gRPC.Message{Sender: body.Bidder, Message: "bid", Bid: body.Amount, Auction: id}
+	return fanOut(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.Publish(ctx, message)
+	})
+}
+
+func bidHistory(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	query := r.URL.Query()
+	request := &gRPC.BidHistoryRequest{AuctionId: id, PageToken: query.Get("page_token")}
+	if size := query.Get("page_size"); size != "" {
+		n, err := strconv.ParseInt(size, 10, 32)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "page_size %q is not a number", size)
+		}
+		request.PageSize = int32(n)
+	}
+	if anonymize := query.Get("anonymize"); anonymize != "" {
+		b, err := strconv.ParseBool(anonymize)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "anonymize %q is not true or false", anonymize)
+		}
+		request.Anonymize = b
+	}
+	return first(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.GetBidHistory(ctx, request)
+	})
+}
+
+func result(ctx context.Context, r *http.Request, id string) (proto.Message, error) {
+	bidder := r.URL.Query().Get("bidder")
+	if bidder == "" {
+		return nil, status.Error(codes.InvalidArgument, "the bidder is missing")
+	}
+	message := &gRPC.Message{Sender: bidder, Message: "result", Auction: id}
+	return first(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.Publish(ctx, message)
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// how often a comment is sent on a quiet event stream, so proxies do not close it
+const keepAlive = 15 * time.Second
+
+// watchEvents streams the updates of the auction as server-sent events, with the sequence of the update as
+// the event id. The replicas number the updates the same, so when the replica being watched goes away the
+// stream goes on from the next one, and a browser that reconnects with Last-Event-ID misses nothing.
+func watchEvents(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return status.Error(codes.Internal, "the connection can not stream")
+	}
+	after, err := lastEventID(r)
+	if err != nil {
+		return err
+	}
+	// finds out if the auction is there and the caller may watch it while an error can still be an HTTP status
+	_, err = first(ctx, func(ctx context.Context, rep replica) (proto.Message, error) {
+		return rep.auction.GetBidHistory(ctx, &gRPC.BidHistoryRequest{AuctionId: id, PageSize: 1})
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 2000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	failed := 0 // replicas that went away in a row without sending anything
+	for i := 0; ; i = (i + 1) % len(replicas) {
+		rep := replicas[i]
+		watchCtx, cancel := context.WithCancel(ctx)
+		updates, errs := watch(watchCtx, rep, id, after)
+		slog.DebugContext(ctx, "watching", "server", rep.addr, "after", after)
+
+		err := func() error {
+			defer cancel()
+			for {
+				select {
+				case update := <-updates:
+					data, err := marshal.Marshal(update)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", update.Sequence, update.Type, data)
+					flusher.Flush()
+					after = update.Sequence
+					failed = 0
+				case err := <-errs:
+					return err
+				case <-ticker.C:
+					fmt.Fprintf(w, ": keep-alive\n\n")
+					flusher.Flush()
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}()
+		if ctx.Err() != nil {
+			slog.DebugContext(ctx, "stopped watching", "after", after)
+			return nil
+		}
+		if !unavailable(err) {
+			slog.InfoContext(ctx, "watch failed", "server", rep.addr, "err", err)
+			writeEventError(w, err)
+			flusher.Flush()
+			return nil
+		}
+		slog.InfoContext(ctx, "replica went away, watching another one", "server", rep.addr, "after", after, "err", err)
+		if failed++; failed >= len(replicas) {
+			// none of them could be watched, waits a bit before going round again
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// watch streams the updates of one replica, until it fails with an error on errs
+func watch(ctx context.Context, rep replica, id string, after uint64) (<-chan *gRPC.AuctionUpdate, <-chan error) {
+	updates := make(chan *gRPC.AuctionUpdate)
+	errs := make(chan error, 1)
+	go func() {
+		stream, err := rep.auction.Watch(ctx, &gRPC.WatchRequest{AuctionId: id, AfterSequence: after})
+		for err == nil {
+			var update *gRPC.AuctionUpdate
+			if update, err = stream.Recv(); err == nil {
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+		errs <- err
+	}()
+	return updates, errs
+}
+
+// the sequence to go on after, from the Last-Event-ID header a browser sends when it reconnects or the
+// after query parameter
+func lastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("after")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	after, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "%q is not the sequence of an update", value)
+	}
+	return after, nil
+}
+
+// ends an event stream that can not go on with an "error" event, the status was sent long ago
+func writeEventError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", errorBody(st.Code().String(), st.Message()))
+}
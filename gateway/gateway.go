@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Serves the auction as HTTP/JSON, for clients that can not speak gRPC, ex.
+// go run ./gateway -servers localhost:5000,localhost:5001,localhost:5002
+// curl -X POST localhost:8000/v1/auctions/default/bids -d '{"bidder": "alice", "amount": 100}'
+// It is a client of the replicas like the others: bids and new auctions are sent to every replica,
+// reads go to the first replica that answers. The spec of the API is served on /openapi.json.
+
+var listenAddr = flag.String("listen", "localhost:8000", "address to serve the HTTP API on")
+var serverAddrs = flag.String("servers", "localhost:5000,localhost:5001,localhost:5002", "comma separated addresses of the replicas")
+var timeout = flag.Duration("timeout", 5*time.Second, "how long to wait for each replica")
+var adminTokenFile = flag.String("admin-token", "", "file with the admin token of the servers, without it admin calls are only accepted from localhost")
+var corsOrigin = flag.String("cors-origin", "", "origin browsers may call the API from, ex. https://auction.example.com or *")
+var tlsCAFile = flag.String("tls-ca", "", "CA certificate to verify the servers with, enables TLS")
+var tlsCertFile = flag.String("tls-cert", "", "client certificate, only needed if the servers ask for one")
+var tlsKeyFile = flag.String("tls-key", "", "private key for -tls-cert")
+var logOutput = flag.String("log-output", "stderr", "where to write logs: stdout, stderr or a file")
+var logFormat = flag.String("log-format", "text", "log format: json or text")
+var logLevel = flag.String("log-level", "info", "lowest level to log: debug, info, warn or error")
+var printSpec = flag.Bool("openapi", false, "print the OpenAPI spec of the API and exit")
+
+// a connection to one replica
+type replica struct {
+	addr    string
+	auction gRPC.AuctionSystemClient
+	admin   gRPC.AuctionAdminClient
+}
+
+var replicas []replica
+var adminToken string
+
+// the json the API reads and writes, with the field names of the proto file
+var marshal = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+var unmarshal = protojson.UnmarshalOptions{}
+
+func main() {
+	flag.Parse()
+	if *printSpec {
+		os.Stdout.Write(openAPISpec())
+		return
+	}
+
+	_, f, err := logging.New(logging.Config{Output: *logOutput, Format: *logFormat, Level: *logLevel}, "gateway", *listenAddr)
+	if err != nil {
+		fmt.Printf("Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if *adminTokenFile != "" {
+		data, err := os.ReadFile(*adminTokenFile)
+		if err != nil {
+			logging.Fatal("failed to load admin token", "file", *adminTokenFile, "err", err)
+		}
+		adminToken = strings.TrimSpace(string(data))
+	}
+
+	creds, err := transportCredentials()
+	if err != nil {
+		logging.Fatal("failed to load TLS credentials", "err", err)
+	}
+	for _, addr := range strings.Split(*serverAddrs, ",") {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds),
+			grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor),
+			grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor))
+		if err != nil {
+			logging.Fatal("failed to dial", "server", addr, "err", err)
+		}
+		replicas = append(replicas, replica{addr: addr, auction: gRPC.NewAuctionSystemClient(conn), admin: gRPC.NewAuctionAdminClient(conn)})
+	}
+
+	slog.Info("serving the HTTP API", "url", "http://"+*listenAddr, "servers", *serverAddrs)
+	fmt.Println("Serving the HTTP API on http://" + *listenAddr)
+	if err := http.ListenAndServe(*listenAddr, http.HandlerFunc(serveHTTP)); err != nil {
+		logging.Fatal("failed to serve", "addr", *listenAddr, "err", err)
+	}
+}
+
+func transportCredentials() (credentials.TransportCredentials, error) {
+	if *tlsCAFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+	data, err := os.ReadFile(*tlsCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", *tlsCAFile)
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if *tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if *corsOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", *corsOrigin)
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if r.URL.Path == "/openapi.json" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec())
+		return
+	}
+
+	rt, id, allowed := match(r.Method, r.URL.Path)
+	if rt == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not allowed here")
+			return
+		}
+		writeError(w, http.StatusNotFound, "NotFound", "there is nothing at "+r.URL.Path)
+		return
+	}
+
+	// the request id goes along to the replicas, so the call can be found in their logs
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = logging.NewRequestID()
+	}
+	w.Header().Set("X-Request-Id", requestID)
+	ctx := logging.With(logging.WithRequestID(r.Context(), requestID), "method", r.Method, "path", r.URL.Path)
+	// the replicas rate limit callers that are not logged in by their host, which would be the gateway's own
+	// for every call without this
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", host)
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", header)
+	} else if token := r.URL.Query().Get("access_token"); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	if rt.admin {
+		if err := checkAdmin(r); err != nil {
+			slog.WarnContext(ctx, "refused admin call", "remote", r.RemoteAddr, "err", err)
+			writeStatus(w, err)
+			return
+		}
+	}
+
+	if rt.stream != nil {
+		if err := rt.stream(ctx, w, r, id); err != nil {
+			slog.InfoContext(ctx, "call failed", "err", err)
+			writeStatus(w, err)
+		}
+		return
+	}
+	response, err := rt.handle(ctx, r, id)
+	if err != nil {
+		slog.InfoContext(ctx, "call failed", "err", err)
+		writeStatus(w, err)
+		return
+	}
+	body, err := marshal.Marshal(response)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+	slog.DebugContext(ctx, "call done")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rt.status)
+	w.Write(body)
+}
+
+// the replicas trust admin calls from localhost when they have no admin token, and the gateway runs next to
+// them, so it has to do the same check for the HTTP caller before passing a call on
+func checkAdmin(r *http.Request) error {
+	if adminToken == "" {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+		return status.Error(codes.PermissionDenied, "admin calls are only accepted from localhost when the gateway has no -admin-token")
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+adminToken)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or wrong admin token")
+	}
+	return nil
+}
+
+// calls every replica at once, and returns the answer of the first replica that took the call. The replicas
+// answer the same, so when none did the error that is not about a replica being down is the most telling.
+func fanOut(ctx context.Context, call func(ctx context.Context, r replica) (proto.Message, error)) (proto.Message, error) {
+	type result struct {
+		response proto.Message
+		err      error
+	}
+	results := make(chan result, len(replicas))
+	for _, r := range replicas {
+		go func(r replica) {
+			callCtx, cancel := context.WithTimeout(ctx, *timeout)
+			defer cancel()
+			response, err := call(callCtx, r)
+			if err != nil {
+				slog.DebugContext(ctx, "replica did not take the call", "server", r.addr, "err", err)
+			}
+			results <- result{response, err}
+		}(r)
+	}
+
+	var response proto.Message
+	var err error
+	for range replicas {
+		res := <-results
+		switch {
+		case res.err == nil && response == nil:
+			response = res.response
+		case res.err != nil && (err == nil || unavailable(err)):
+			err = res.err
+		}
+	}
+	if response != nil {
+		return response, nil
+	}
+	return nil, err
+}
+
+// calls the replicas one at a time until one answers
+func first(ctx context.Context, call func(ctx context.Context, r replica) (proto.Message, error)) (proto.Message, error) {
+	var err error
+	for _, r := range replicas {
+		callCtx, cancel := context.WithTimeout(ctx, *timeout)
+		var response proto.Message
+		response, err = call(callCtx, r)
+		cancel()
+		if err == nil {
+			return response, nil
+		}
+		slog.DebugContext(ctx, "replica did not answer", "server", r.addr, "err", err)
+		if !unavailable(err) {
+			// the others would say the same
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// reports if err means the replica is down, recovering or has lost its quorum, so another one may do better
+func unavailable(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+// the HTTP status a gRPC error is answered with
+var httpStatus = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.Aborted:            http.StatusConflict,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+}
+
+// writes err as an error body, with the status that fits its gRPC code
+func writeStatus(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code, ok := httpStatus[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := int(info.RetryDelay.AsDuration().Seconds() + 0.999)
+			w.Header().Set("Retry-After", fmt.Sprint(max(seconds, 1)))
+		}
+	}
+	writeError(w, code, st.Code().String(), st.Message())
+}
+
+func writeError(w http.ResponseWriter, code int, name string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(errorBody(name, message), '\n'))
+}
+
+// ex. {"code":"NotFound","message":"there is no auction \"car\""}
+func errorBody(name string, message string) []byte {
+	data, _ := json.Marshal(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{name, message})
+	return data
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The OpenAPI spec is made from the routes and the proto messages they read and write, so it can not drift
+// from what the gateway does. The json field names are the ones of the proto file, and 64 bit numbers are
+// strings, like protojson writes them.
+
+// the schemas of bodies that are not proto messages
+var handSchemas = map[string]any{
+	"BidRequest": map[string]any{
+		"type":     "object",
+		"required": []string{"bidder", "amount"},
+		"properties": map[string]any{
+			"bidder": map[string]any{"type": "string"},
+			"amount": map[string]any{"type": "integer", "format": "int64", "minimum": 1},
+		},
+	},
+	"Error": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "string", "description": "the gRPC code of the error, ex. NotFound"},
+			"message": map[string]any{"type": "string"},
+		},
+	},
+}
+
+var openAPISpec = sync.OnceValue(func() []byte {
+	schemas := map[string]any{}
+	for name, schema := range handSchemas {
+		schemas[name] = schema
+	}
+
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		var parameters []any
+		if strings.Contains(rt.path, "{id}") {
+			parameters = append(parameters, map[string]any{
+				"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}, "description": "the id of the auction",
+			})
+		}
+		for _, q := range rt.query {
+			parameters = append(parameters, map[string]any{
+				"name": q.name, "in": "query", "schema": map[string]any{"type": q.kind}, "description": q.description,
+			})
+		}
+
+		responseName := addSchema(rt.response.ProtoReflect().Descriptor(), schemas)
+		response := jsonContent(http.StatusText(rt.status), responseName)
+		if rt.stream != nil {
+			response = map[string]any{
+				"description": "a server-sent event for every update, the id is its sequence, the event its type and the data the update as json",
+				"content": map[string]any{
+					"text/event-stream": map[string]any{"schema": ref(responseName)},
+				},
+			}
+		}
+		operation := map[string]any{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"responses": map[string]any{
+				strconv.Itoa(rt.status): response,
+				"default":               jsonContent("the error, with the gRPC code the replicas answered with", "Error"),
+			},
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		bodyName := rt.bodyName
+		if rt.body != nil {
+			bodyName = addSchema(rt.body.ProtoReflect().Descriptor(), schemas)
+		}
+		if bodyName != "" {
+			body := jsonContent("", bodyName)
+			delete(body, "description")
+			body["required"] = true
+			operation["requestBody"] = body
+		}
+		if rt.admin {
+			operation["security"] = []any{map[string]any{"bearer": []string{}}}
+			operation["description"] = "An admin call. With no -admin-token it is only accepted from localhost, else the admin token has to be sent."
+		} else {
+			// the login token is only needed when the servers have authentication enabled
+			operation["security"] = []any{map[string]any{}, map[string]any{"bearer": []string{}}}
+		}
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = operation
+	}
+
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Auction system",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+})
+
+// ex. "post_v1_auctions_id_bids"
+func operationID(rt route) string {
+	return strings.ToLower(rt.method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(rt.path)
+}
+
+func jsonContent(description string, schema string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": ref(schema)},
+		},
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// adds the schema of the message, and of every message and enum it uses, and returns its name
+func addSchema(md protoreflect.MessageDescriptor, schemas map[string]any) string {
+	name := string(md.Name())
+	if _, ok := schemas[name]; ok {
+		return name
+	}
+	properties := map[string]any{}
+	schema := map[string]any{"type": "object", "properties": properties}
+	schemas[name] = schema // before the fields, in case a message uses itself
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		field := fieldSchema(fd, schemas)
+		if fd.IsList() {
+			field = map[string]any{"type": "array", "items": field}
+		}
+		properties[string(fd.Name())] = field
+	}
+	return name
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas map[string]any) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": "string", "format": "uint64"}
+	case protoreflect.FloatKind:
+		return map[string]any{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return map[string]any{"type": "number", "format": "double"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		ed := fd.Enum()
+		name := string(ed.Name())
+		if _, ok := schemas[name]; !ok {
+			var values []string
+			for i := 0; i < ed.Values().Len(); i++ {
+				values = append(values, string(ed.Values().Get(i).Name()))
+			}
+			schemas[name] = map[string]any{"type": "string", "enum": values}
+		}
+		return ref(name)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return ref(addSchema(fd.Message(), schemas))
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
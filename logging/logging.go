@@ -0,0 +1,143 @@
+// Package logging sets up leveled, structured logging with log/slog, and carries
+// request ids and other fields through contexts and gRPC metadata so one request
+// can be followed across the client and every replica.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the gRPC metadata key the request id is sent in
+const RequestIDHeader = "x-request-id"
+
+// Config says where logs go and what they look like
+type Config struct {
+	Output string // "stdout", "stderr" or a file path, files are appended to
+	Format string // "json" or "text"
+	Level  string // "debug", "info", "warn" or "error"
+}
+
+// New makes a logger from the config and sets it as the default logger, so the log and
+// slog package functions use it too. The returned closer closes the log file, if any.
+func New(config Config, attrs ...any) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, nil, fmt.Errorf("unknown log level %q", config.Level)
+	}
+
+	var out io.WriteCloser
+	switch config.Output {
+	case "stdout":
+		out = nopCloser{os.Stdout}
+	case "stderr", "":
+		out = nopCloser{os.Stderr}
+	default:
+		f, err := os.OpenFile(config.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = f
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	default:
+		out.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", config.Format)
+	}
+
+	logger := slog.New(contextHandler{handler}).With(attrs...)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return logger, out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Fatal logs at error level and exits, like log.Fatal
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type attrsKey struct{}
+
+// With returns a context carrying fields that are added to everything logged with it,
+// ex. logging.With(ctx, "bidder", name)
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsKey{}).([]any)
+	combined := make([]any, 0, len(attrs)+len(args))
+	combined = append(append(combined, attrs...), args...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// contextHandler adds the fields from With to every record logged with a context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]any); ok {
+		record.Add(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewRequestID makes a random id for a request
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context that logs the request id and sends it along with outgoing gRPC calls
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	ctx = metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id)
+	return With(ctx, "request_id", id)
+}
+
+// RequestID returns the request id of ctx, or "" if it has none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// IncomingRequestID returns the request id sent by the caller of a gRPC call,
+// or a new one if the caller did not send any
+func IncomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	return NewRequestID()
+}
@@ -1,4 +1,8 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.7
+// source: proto/AuctionSystem.proto
 
 package proto
 
@@ -22,6 +26,16 @@ type AuctionSystemClient interface {
 	Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (AuctionSystem_JoinClient, error)
 	// publish a message in the chat
 	Publish(ctx context.Context, in *Message, opts ...grpc.CallOption) (*PublishResponse, error)
+	// log in as a registered bidder, the token goes in the "authorization" metadata of the other calls
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// the accepted bids of an auction, oldest first. Every replica numbers the bids the same,
+	// so the pages can be read from any of them.
+	GetBidHistory(ctx context.Context, in *BidHistoryRequest, opts ...grpc.CallOption) (*BidHistoryResponse, error)
+	// the auctions bidders can see, which is every auction but the drafts
+	ListAuctions(ctx context.Context, in *ListAuctionsRequest, opts ...grpc.CallOption) (*ListAuctionsResponse, error)
+	// the updates of an auction after after_sequence, then every new one as it happens. Every replica numbers
+	// the updates the same, so a watcher that loses its replica can carry on from another one.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (AuctionSystem_WatchClient, error)
 }
 
 type auctionSystemClient struct {
@@ -73,6 +87,65 @@ func (c *auctionSystemClient) Publish(ctx context.Context, in *Message, opts ...
 	return out, nil
 }
 
+func (c *auctionSystemClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, "/proto.AuctionSystem/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionSystemClient) GetBidHistory(ctx context.Context, in *BidHistoryRequest, opts ...grpc.CallOption) (*BidHistoryResponse, error) {
+	out := new(BidHistoryResponse)
+	err := c.cc.Invoke(ctx, "/proto.AuctionSystem/GetBidHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionSystemClient) ListAuctions(ctx context.Context, in *ListAuctionsRequest, opts ...grpc.CallOption) (*ListAuctionsResponse, error) {
+	out := new(ListAuctionsResponse)
+	err := c.cc.Invoke(ctx, "/proto.AuctionSystem/ListAuctions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionSystemClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (AuctionSystem_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AuctionSystem_ServiceDesc.Streams[1], "/proto.AuctionSystem/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &auctionSystemWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AuctionSystem_WatchClient interface {
+	Recv() (*AuctionUpdate, error)
+	grpc.ClientStream
+}
+
+type auctionSystemWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *auctionSystemWatchClient) Recv() (*AuctionUpdate, error) {
+	m := new(AuctionUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // AuctionSystemServer is the server API for AuctionSystem service.
 // All implementations must embed UnimplementedAuctionSystemServer
 // for forward compatibility
@@ -81,6 +154,16 @@ type AuctionSystemServer interface {
 	Join(*JoinRequest, AuctionSystem_JoinServer) error
 	// publish a message in the chat
 	Publish(context.Context, *Message) (*PublishResponse, error)
+	// log in as a registered bidder, the token goes in the "authorization" metadata of the other calls
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// the accepted bids of an auction, oldest first. Every replica numbers the bids the same,
+	// so the pages can be read from any of them.
+	GetBidHistory(context.Context, *BidHistoryRequest) (*BidHistoryResponse, error)
+	// the auctions bidders can see, which is every auction but the drafts
+	ListAuctions(context.Context, *ListAuctionsRequest) (*ListAuctionsResponse, error)
+	// the updates of an auction after after_sequence, then every new one as it happens. Every replica numbers
+	// the updates the same, so a watcher that loses its replica can carry on from another one.
+	Watch(*WatchRequest, AuctionSystem_WatchServer) error
 	mustEmbedUnimplementedAuctionSystemServer()
 }
 
@@ -94,6 +177,18 @@ func (UnimplementedAuctionSystemServer) Join(*JoinRequest, AuctionSystem_JoinSer
 func (UnimplementedAuctionSystemServer) Publish(context.Context, *Message) (*PublishResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
 }
+func (UnimplementedAuctionSystemServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedAuctionSystemServer) GetBidHistory(context.Context, *BidHistoryRequest) (*BidHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBidHistory not implemented")
+}
+func (UnimplementedAuctionSystemServer) ListAuctions(context.Context, *ListAuctionsRequest) (*ListAuctionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuctions not implemented")
+}
+func (UnimplementedAuctionSystemServer) Watch(*WatchRequest, AuctionSystem_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedAuctionSystemServer) mustEmbedUnimplementedAuctionSystemServer() {}
 
 // UnsafeAuctionSystemServer may be embedded to opt out of forward compatibility for this service.
@@ -146,6 +241,81 @@ func _AuctionSystem_Publish_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuctionSystem_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionSystemServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionSystem/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionSystemServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionSystem_GetBidHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BidHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionSystemServer).GetBidHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionSystem/GetBidHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionSystemServer).GetBidHistory(ctx, req.(*BidHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionSystem_ListAuctions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuctionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionSystemServer).ListAuctions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionSystem/ListAuctions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionSystemServer).ListAuctions(ctx, req.(*ListAuctionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionSystem_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuctionSystemServer).Watch(m, &auctionSystemWatchServer{stream})
+}
+
+type AuctionSystem_WatchServer interface {
+	Send(*AuctionUpdate) error
+	grpc.ServerStream
+}
+
+type auctionSystemWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *auctionSystemWatchServer) Send(m *AuctionUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // AuctionSystem_ServiceDesc is the grpc.ServiceDesc for AuctionSystem service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -157,6 +327,18 @@ var AuctionSystem_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Publish",
 			Handler:    _AuctionSystem_Publish_Handler,
 		},
+		{
+			MethodName: "Login",
+			Handler:    _AuctionSystem_Login_Handler,
+		},
+		{
+			MethodName: "GetBidHistory",
+			Handler:    _AuctionSystem_GetBidHistory_Handler,
+		},
+		{
+			MethodName: "ListAuctions",
+			Handler:    _AuctionSystem_ListAuctions_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -164,6 +346,685 @@ var AuctionSystem_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _AuctionSystem_Join_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Watch",
+			Handler:       _AuctionSystem_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/AuctionSystem.proto",
+}
+
+// ReplicaClient is the client API for Replica service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ReplicaClient interface {
+	// the current state of the auctions, used by a replica catching up after a (re)start
+	GetState(ctx context.Context, in *StateRequest, opts ...grpc.CallOption) (*Snapshot, error)
+	// swaps -replica numbers with the peer, whatever address each is known by. The live replica with the lowest
+	// number sends the webhooks and settles auctions first. Fails if the peer has the same number.
+	// Called again every few seconds to measure the replication lag.
+	Identify(ctx context.Context, in *IdentifyRequest, opts ...grpc.CallOption) (*IdentifyResponse, error)
+	// asks the peer to let the claimant settle a closed auction, so the post-close hooks run on one replica.
+	// A peer grants one claimant at a time until its lease runs out.
+	ClaimSettlement(ctx context.Context, in *ClaimSettlementRequest, opts ...grpc.CallOption) (*ClaimSettlementResponse, error)
+	// tells the peer the claimant has settled the auction
+	Settled(ctx context.Context, in *SettledRequest, opts ...grpc.CallOption) (*SettledResponse, error)
+	// tells the peer the replica is shutting down. The peer stops counting it as live, so another replica sends
+	// the webhooks, and settles the auctions it had claimed without waiting for the leases to run out.
+	Leaving(ctx context.Context, in *LeavingRequest, opts ...grpc.CallOption) (*LeavingResponse, error)
+}
+
+type replicaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReplicaClient(cc grpc.ClientConnInterface) ReplicaClient {
+	return &replicaClient{cc}
+}
+
+func (c *replicaClient) GetState(ctx context.Context, in *StateRequest, opts ...grpc.CallOption) (*Snapshot, error) {
+	out := new(Snapshot)
+	err := c.cc.Invoke(ctx, "/proto.Replica/GetState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) Identify(ctx context.Context, in *IdentifyRequest, opts ...grpc.CallOption) (*IdentifyResponse, error) {
+	out := new(IdentifyResponse)
+	err := c.cc.Invoke(ctx, "/proto.Replica/Identify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) ClaimSettlement(ctx context.Context, in *ClaimSettlementRequest, opts ...grpc.CallOption) (*ClaimSettlementResponse, error) {
+	out := new(ClaimSettlementResponse)
+	err := c.cc.Invoke(ctx, "/proto.Replica/ClaimSettlement", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) Settled(ctx context.Context, in *SettledRequest, opts ...grpc.CallOption) (*SettledResponse, error) {
+	out := new(SettledResponse)
+	err := c.cc.Invoke(ctx, "/proto.Replica/Settled", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicaClient) Leaving(ctx context.Context, in *LeavingRequest, opts ...grpc.CallOption) (*LeavingResponse, error) {
+	out := new(LeavingResponse)
+	err := c.cc.Invoke(ctx, "/proto.Replica/Leaving", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplicaServer is the server API for Replica service.
+// All implementations must embed UnimplementedReplicaServer
+// for forward compatibility
+type ReplicaServer interface {
+	// the current state of the auctions, used by a replica catching up after a (re)start
+	GetState(context.Context, *StateRequest) (*Snapshot, error)
+	// swaps -replica numbers with the peer, whatever address each is known by. The live replica with the lowest
+	// number sends the webhooks and settles auctions first. Fails if the peer has the same number.
+	// Called again every few seconds to measure the replication lag.
+	Identify(context.Context, *IdentifyRequest) (*IdentifyResponse, error)
+	// asks the peer to let the claimant settle a closed auction, so the post-close hooks run on one replica.
+	// A peer grants one claimant at a time until its lease runs out.
+	ClaimSettlement(context.Context, *ClaimSettlementRequest) (*ClaimSettlementResponse, error)
+	// tells the peer the claimant has settled the auction
+	Settled(context.Context, *SettledRequest) (*SettledResponse, error)
+	// tells the peer the replica is shutting down. The peer stops counting it as live, so another replica sends
+	// the webhooks, and settles the auctions it had claimed without waiting for the leases to run out.
+	Leaving(context.Context, *LeavingRequest) (*LeavingResponse, error)
+	mustEmbedUnimplementedReplicaServer()
+}
+
+// UnimplementedReplicaServer must be embedded to have forward compatible implementations.
+type UnimplementedReplicaServer struct {
+}
+
+func (UnimplementedReplicaServer) GetState(context.Context, *StateRequest) (*Snapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedReplicaServer) Identify(context.Context, *IdentifyRequest) (*IdentifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Identify not implemented")
+}
+func (UnimplementedReplicaServer) ClaimSettlement(context.Context, *ClaimSettlementRequest) (*ClaimSettlementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClaimSettlement not implemented")
+}
+func (UnimplementedReplicaServer) Settled(context.Context, *SettledRequest) (*SettledResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Settled not implemented")
+}
+func (UnimplementedReplicaServer) Leaving(context.Context, *LeavingRequest) (*LeavingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leaving not implemented")
+}
+func (UnimplementedReplicaServer) mustEmbedUnimplementedReplicaServer() {}
+
+// UnsafeReplicaServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReplicaServer will
+// result in compilation errors.
+type UnsafeReplicaServer interface {
+	mustEmbedUnimplementedReplicaServer()
+}
+
+func RegisterReplicaServer(s grpc.ServiceRegistrar, srv ReplicaServer) {
+	s.RegisterService(&Replica_ServiceDesc, srv)
+}
+
+func _Replica_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Replica/GetState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).GetState(ctx, req.(*StateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_Identify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdentifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).Identify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Replica/Identify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).Identify(ctx, req.(*IdentifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_ClaimSettlement_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClaimSettlementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).ClaimSettlement(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Replica/ClaimSettlement",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).ClaimSettlement(ctx, req.(*ClaimSettlementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_Settled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SettledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).Settled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Replica/Settled",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).Settled(ctx, req.(*SettledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replica_Leaving_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeavingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicaServer).Leaving(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Replica/Leaving",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicaServer).Leaving(ctx, req.(*LeavingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Replica_ServiceDesc is the grpc.ServiceDesc for Replica service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Replica_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Replica",
+	HandlerType: (*ReplicaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _Replica_GetState_Handler,
+		},
+		{
+			MethodName: "Identify",
+			Handler:    _Replica_Identify_Handler,
+		},
+		{
+			MethodName: "ClaimSettlement",
+			Handler:    _Replica_ClaimSettlement_Handler,
+		},
+		{
+			MethodName: "Settled",
+			Handler:    _Replica_Settled_Handler,
+		},
+		{
+			MethodName: "Leaving",
+			Handler:    _Replica_Leaving_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/AuctionSystem.proto",
+}
+
+// AuctionAdminClient is the client API for AuctionAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AuctionAdminClient interface {
+	// creates the auction as a DRAFT, SCHEDULED to open at starts_at, or OPEN right away
+	CreateAuction(ctx context.Context, in *CreateAuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	// schedules a DRAFT auction to open at starts_at
+	ScheduleAuction(ctx context.Context, in *ScheduleAuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	// opens a DRAFT or SCHEDULED auction now
+	OpenAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	ListAuctions(ctx context.Context, in *ListAuctionsRequest, opts ...grpc.CallOption) (*ListAuctionsResponse, error)
+	// ends the auction now, the highest bid so far wins
+	CloseAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	// ends the auction now without a winner, the highest bid is no longer held
+	CancelAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	// stops the clock of the auction and turns down bids, until it is resumed with the time that was left
+	PauseAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	ResumeAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error)
+	// turns down everything the bidder does from now on and disconnects them, bids they already made stand
+	BanBidder(ctx context.Context, in *BanBidderRequest, opts ...grpc.CallOption) (*BanBidderResponse, error)
+	// the health of the replica, its peers and how far its audit log has got
+	GetReplicaState(ctx context.Context, in *ReplicaStateRequest, opts ...grpc.CallOption) (*ReplicaState, error)
+}
+
+type auctionAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuctionAdminClient(cc grpc.ClientConnInterface) AuctionAdminClient {
+	return &auctionAdminClient{cc}
+}
+
+func (c *auctionAdminClient) CreateAuction(ctx context.Context, in *CreateAuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/CreateAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) ScheduleAuction(ctx context.Context, in *ScheduleAuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/ScheduleAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) OpenAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/OpenAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) ListAuctions(ctx context.Context, in *ListAuctionsRequest, opts ...grpc.CallOption) (*ListAuctionsResponse, error) {
+	out := new(ListAuctionsResponse)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/ListAuctions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) CloseAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/CloseAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) CancelAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/CancelAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) PauseAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/PauseAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) ResumeAuction(ctx context.Context, in *AuctionRequest, opts ...grpc.CallOption) (*AuctionInfo, error) {
+	out := new(AuctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/ResumeAuction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) BanBidder(ctx context.Context, in *BanBidderRequest, opts ...grpc.CallOption) (*BanBidderResponse, error) {
+	out := new(BanBidderResponse)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/BanBidder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *auctionAdminClient) GetReplicaState(ctx context.Context, in *ReplicaStateRequest, opts ...grpc.CallOption) (*ReplicaState, error) {
+	out := new(ReplicaState)
+	err := c.cc.Invoke(ctx, "/proto.AuctionAdmin/GetReplicaState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuctionAdminServer is the server API for AuctionAdmin service.
+// All implementations must embed UnimplementedAuctionAdminServer
+// for forward compatibility
+type AuctionAdminServer interface {
+	// creates the auction as a DRAFT, SCHEDULED to open at starts_at, or OPEN right away
+	CreateAuction(context.Context, *CreateAuctionRequest) (*AuctionInfo, error)
+	// schedules a DRAFT auction to open at starts_at
+	ScheduleAuction(context.Context, *ScheduleAuctionRequest) (*AuctionInfo, error)
+	// opens a DRAFT or SCHEDULED auction now
+	OpenAuction(context.Context, *AuctionRequest) (*AuctionInfo, error)
+	ListAuctions(context.Context, *ListAuctionsRequest) (*ListAuctionsResponse, error)
+	// ends the auction now, the highest bid so far wins
+	CloseAuction(context.Context, *AuctionRequest) (*AuctionInfo, error)
+	// ends the auction now without a winner, the highest bid is no longer held
+	CancelAuction(context.Context, *AuctionRequest) (*AuctionInfo, error)
+	// stops the clock of the auction and turns down bids, until it is resumed with the time that was left
+	PauseAuction(context.Context, *AuctionRequest) (*AuctionInfo, error)
+	ResumeAuction(context.Context, *AuctionRequest) (*AuctionInfo, error)
+	// turns down everything the bidder does from now on and disconnects them, bids they already made stand
+	BanBidder(context.Context, *BanBidderRequest) (*BanBidderResponse, error)
+	// the health of the replica, its peers and how far its audit log has got
+	GetReplicaState(context.Context, *ReplicaStateRequest) (*ReplicaState, error)
+	mustEmbedUnimplementedAuctionAdminServer()
+}
+
+// UnimplementedAuctionAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAuctionAdminServer struct {
+}
+
+func (UnimplementedAuctionAdminServer) CreateAuction(context.Context, *CreateAuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) ScheduleAuction(context.Context, *ScheduleAuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScheduleAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) OpenAuction(context.Context, *AuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OpenAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) ListAuctions(context.Context, *ListAuctionsRequest) (*ListAuctionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuctions not implemented")
+}
+func (UnimplementedAuctionAdminServer) CloseAuction(context.Context, *AuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) CancelAuction(context.Context, *AuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) PauseAuction(context.Context, *AuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) ResumeAuction(context.Context, *AuctionRequest) (*AuctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeAuction not implemented")
+}
+func (UnimplementedAuctionAdminServer) BanBidder(context.Context, *BanBidderRequest) (*BanBidderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanBidder not implemented")
+}
+func (UnimplementedAuctionAdminServer) GetReplicaState(context.Context, *ReplicaStateRequest) (*ReplicaState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReplicaState not implemented")
+}
+func (UnimplementedAuctionAdminServer) mustEmbedUnimplementedAuctionAdminServer() {}
+
+// UnsafeAuctionAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AuctionAdminServer will
+// result in compilation errors.
+type UnsafeAuctionAdminServer interface {
+	mustEmbedUnimplementedAuctionAdminServer()
+}
+
+func RegisterAuctionAdminServer(s grpc.ServiceRegistrar, srv AuctionAdminServer) {
+	s.RegisterService(&AuctionAdmin_ServiceDesc, srv)
+}
+
+func _AuctionAdmin_CreateAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).CreateAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/CreateAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).CreateAuction(ctx, req.(*CreateAuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_ScheduleAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleAuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).ScheduleAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/ScheduleAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).ScheduleAuction(ctx, req.(*ScheduleAuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_OpenAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).OpenAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/OpenAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).OpenAuction(ctx, req.(*AuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_ListAuctions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuctionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).ListAuctions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/ListAuctions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).ListAuctions(ctx, req.(*ListAuctionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_CloseAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).CloseAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/CloseAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).CloseAuction(ctx, req.(*AuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_CancelAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).CancelAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/CancelAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).CancelAuction(ctx, req.(*AuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_PauseAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).PauseAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/PauseAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).PauseAuction(ctx, req.(*AuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_ResumeAuction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).ResumeAuction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/ResumeAuction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).ResumeAuction(ctx, req.(*AuctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_BanBidder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanBidderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).BanBidder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/BanBidder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).BanBidder(ctx, req.(*BanBidderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuctionAdmin_GetReplicaState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicaStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuctionAdminServer).GetReplicaState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.AuctionAdmin/GetReplicaState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuctionAdminServer).GetReplicaState(ctx, req.(*ReplicaStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AuctionAdmin_ServiceDesc is the grpc.ServiceDesc for AuctionAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AuctionAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.AuctionAdmin",
+	HandlerType: (*AuctionAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAuction",
+			Handler:    _AuctionAdmin_CreateAuction_Handler,
+		},
+		{
+			MethodName: "ScheduleAuction",
+			Handler:    _AuctionAdmin_ScheduleAuction_Handler,
+		},
+		{
+			MethodName: "OpenAuction",
+			Handler:    _AuctionAdmin_OpenAuction_Handler,
+		},
+		{
+			MethodName: "ListAuctions",
+			Handler:    _AuctionAdmin_ListAuctions_Handler,
+		},
+		{
+			MethodName: "CloseAuction",
+			Handler:    _AuctionAdmin_CloseAuction_Handler,
+		},
+		{
+			MethodName: "CancelAuction",
+			Handler:    _AuctionAdmin_CancelAuction_Handler,
+		},
+		{
+			MethodName: "PauseAuction",
+			Handler:    _AuctionAdmin_PauseAuction_Handler,
+		},
+		{
+			MethodName: "ResumeAuction",
+			Handler:    _AuctionAdmin_ResumeAuction_Handler,
+		},
+		{
+			MethodName: "BanBidder",
+			Handler:    _AuctionAdmin_BanBidder_Handler,
+		},
+		{
+			MethodName: "GetReplicaState",
+			Handler:    _AuctionAdmin_GetReplicaState_Handler,
+		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/AuctionSystem.proto",
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const adminPrefix = "/proto.AuctionAdmin/"
+
+// the token admin calls have to send, empty if only calls from localhost are let through
+var adminToken string
+
+// auction ids are used in logs, metrics and file names, so they are kept simple
+var auctionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// reads the admin token from a file, ex. one made with "openssl rand -hex 32 > admin.token"
+func loadAdminToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if len(token) < 16 {
+		return "", errors.New("admin token must be at least 16 bytes")
+	}
+	return token, nil
+}
+
+// adminInterceptor lets admin calls through if they carry the admin token, or, when the server has
+// no admin token, if they come from localhost. Calls to the other services are left alone.
+func adminInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, adminPrefix) {
+		return handler(ctx, req)
+	}
+	if err := checkAdmin(ctx); err != nil {
+		slog.WarnContext(ctx, "refused admin call", "method", info.FullMethod, "err", err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func checkAdmin(ctx context.Context) error {
+	if adminToken == "" {
+		if p, ok := peer.FromContext(ctx); ok {
+			if addr, ok := p.Addr.(*net.TCPAddr); ok && addr.IP.IsLoopback() {
+				return nil
+			}
+		}
+		return status.Error(codes.PermissionDenied, "admin calls are only accepted from localhost when the server has no -admin-token")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || subtle.ConstantTimeCompare([]byte(values[0]), []byte("Bearer "+adminToken)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or wrong admin token")
+	}
+	return nil
+}
+
+func bannedError() error {
+	return status.Error(codes.PermissionDenied, "you have been banned from the auction")
+}
+
+func isBanned(name string) bool {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	return banned[name]
+}
+
+// admin serves the AuctionAdmin service
+type admin struct {
+	gRPC.UnimplementedAuctionAdminServer
+	sessions *sessionHub
+}
+
+func (s *admin) CreateAuction(ctx context.Context, request *gRPC.CreateAuctionRequest) (*gRPC.AuctionInfo, error) {
+	if !auctionIDPattern.MatchString(request.Id) {
+		return nil, status.Error(codes.InvalidArgument, "auction ids are 1 to 64 letters, digits, '.', '_' or '-'")
+	}
+	if request.Reserve < 0 || request.DurationMs < 0 {
+		return nil, status.Error(codes.InvalidArgument, "reserve and duration must not be negative")
+	}
+	if request.Draft && request.StartsAt != 0 {
+		return nil, status.Error(codes.InvalidArgument, "a draft can not have a start time, schedule it later")
+	}
+	duration := time.Duration(request.DurationMs) * time.Millisecond
+	if duration == 0 {
+		duration = *auctionDuration
+	}
+
+	ctx = logging.With(ctx, "auction", request.Id)
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if !serving() {
+		return nil, notServingError()
+	}
+	if _, ok := auctions[request.Id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "auction %q already exists", request.Id)
+	}
+
+	a := newAuction(request.Id, request.Reserve, duration)
+	auctions[a.id] = a
+	slog.InfoContext(ctx, "auction created", "reserve", a.reserve, "duration", a.duration)
+	record(ctx, audit.Entry{Event: audit.Created, Auction: a.id, Amount: a.reserve})
+	switch {
+	case request.Draft:
+	case time.UnixMilli(request.StartsAt).After(time.Now()):
+		scheduleAuction(ctx, a, time.UnixMilli(request.StartsAt), s.sessions)
+	default:
+		openAuction(ctx, a, s.sessions)
+	}
+	return a.info(), nil
+}
+
+func (s *admin) ScheduleAuction(ctx context.Context, request *gRPC.ScheduleAuctionRequest) (*gRPC.AuctionInfo, error) {
+	startsAt := time.UnixMilli(request.StartsAt)
+	if !startsAt.After(time.Now()) {
+		return nil, status.Error(codes.InvalidArgument, "the start time must be in the future")
+	}
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		return scheduleAuction(ctx, a, startsAt, s.sessions)
+	})
+}
+
+func (s *admin) OpenAuction(ctx context.Context, request *gRPC.AuctionRequest) (*gRPC.AuctionInfo, error) {
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		return openAuction(ctx, a, s.sessions)
+	})
+}
+
+func (s *admin) ListAuctions(ctx context.Context, request *gRPC.ListAuctionsRequest) (*gRPC.ListAuctionsResponse, error) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	response := &gRPC.ListAuctionsResponse{}
+	for _, a := range sortedAuctions() {
+		response.Auctions = append(response.Auctions, a.info())
+	}
+	return response, nil
+}
+
+func (s *admin) CloseAuction(ctx context.Context, request *gRPC.AuctionRequest) (*gRPC.AuctionInfo, error) {
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		slog.InfoContext(ctx, "closing auction early")
+		return closeAuction(ctx, a, s.sessions)
+	})
+}
+
+func (s *admin) CancelAuction(ctx context.Context, request *gRPC.AuctionRequest) (*gRPC.AuctionInfo, error) {
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		return cancelAuction(ctx, a, s.sessions, request.Reason)
+	})
+}
+
+func (s *admin) PauseAuction(ctx context.Context, request *gRPC.AuctionRequest) (*gRPC.AuctionInfo, error) {
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		return pauseAuction(ctx, a, s.sessions)
+	})
+}
+
+func (s *admin) ResumeAuction(ctx context.Context, request *gRPC.AuctionRequest) (*gRPC.AuctionInfo, error) {
+	return s.changeAuction(ctx, request.Id, func(ctx context.Context, a *auction) error {
+		return resumeAuction(ctx, a, s.sessions)
+	})
+}
+
+// looks up the auction and runs change on it holding auctionMu
+func (s *admin) changeAuction(ctx context.Context, id string, change func(ctx context.Context, a *auction) error) (*gRPC.AuctionInfo, error) {
+	ctx = logging.With(ctx, "auction", id)
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if !serving() {
+		return nil, notServingError()
+	}
+	a, ok := auctions[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "there is no auction %q", id)
+	}
+	if err := change(ctx, a); err != nil {
+		return nil, err
+	}
+	return a.info(), nil
+}
+
+func (s *admin) BanBidder(ctx context.Context, request *gRPC.BanBidderRequest) (*gRPC.BanBidderResponse, error) {
+	if request.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "the name of the bidder is missing")
+	}
+
+	ctx = logging.With(ctx, "bidder", request.Name)
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if !serving() {
+		return nil, notServingError()
+	}
+	if banned[request.Name] {
+		return &gRPC.BanBidderResponse{}, nil
+	}
+
+	banned[request.Name] = true
+	slog.InfoContext(ctx, "bidder banned", "reason", request.Reason)
+	record(ctx, audit.Entry{Event: audit.Banned, Bidder: request.Name, Reason: request.Reason})
+	s.sessions.closeBidder(request.Name, bannedError())
+	return &gRPC.BanBidderResponse{}, nil
+}
+
+func (s *admin) GetReplicaState(ctx context.Context, request *gRPC.ReplicaStateRequest) (*gRPC.ReplicaState, error) {
+	health, _ := healthServer.Check(ctx, &healthpb.HealthCheckRequest{Service: auctionService})
+	seq, hash := auditLog.Position()
+	state := &gRPC.ReplicaState{
+		ReplicaId:   replicaID,
+		Health:      health.GetStatus().String(),
+		LogSeq:      seq,
+		LogHash:     hash,
+		Subscribers: int32(len(s.sessions.sessions(""))),
+	}
+
+	healthMu.Lock()
+	state.Recovering = recovering
+	state.Draining = draining
+	for addr, live := range livePeers {
+		state.Peers = append(state.Peers, &gRPC.PeerState{Addr: addr, Live: live})
+	}
+	healthMu.Unlock()
+	sort.Slice(state.Peers, func(i, j int) bool { return state.Peers[i].Addr < state.Peers[j].Addr })
+
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	state.Auctions = int32(len(auctions))
+	for _, a := range auctions {
+		if a.active() {
+			state.OpenAuctions++
+		}
+	}
+	for name := range banned {
+		state.Banned = append(state.Banned, name)
+	}
+	sort.Strings(state.Banned)
+	return state, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the auction that is there from the start, and that bids without an auction go to
+const defaultAuction = "default"
+
+// auction is one auction and its highest bid. Every field is guarded by auctionMu.
+type auction struct {
+	id       string
+	reserve  int64         // the lowest bid that is accepted
+	duration time.Duration // how long the auction is open
+	created  time.Time
+
+	amount int64       // the highest bid
+	bidder string      // who made the highest bid
+	bids   []*gRPC.Bid // every accepted bid, oldest first
+
+	state    gRPC.AuctionState
+	history  []*gRPC.AuctionEvent // every change of state, oldest first
+	startsAt time.Time            // when a SCHEDULED auction opens
+	ends     time.Time            // zero until the auction opens, and while paused
+
+	remaining time.Duration // the time that was left when the auction was paused
+	timer     *time.Timer   // opens a scheduled auction, or closes an open one when it runs out
+
+	order *gRPC.Order // the winning bid, once the auction has closed
+	claim claim       // the replica that may settle the auction, see settle.go
+
+	updates []*gRPC.AuctionUpdate // every bid, retraction and change of state, oldest first, see feed.go
+	changed chan struct{}         // closed on the next update, nil if nobody is waiting for it
+}
+
+// the changes of state that are allowed, CLOSING is only passed through on the way to CLOSED
+var transitions = map[gRPC.AuctionState][]gRPC.AuctionState{
+	gRPC.AuctionState_DRAFT:     {gRPC.AuctionState_SCHEDULED, gRPC.AuctionState_OPEN, gRPC.AuctionState_CANCELLED},
+	gRPC.AuctionState_SCHEDULED: {gRPC.AuctionState_OPEN, gRPC.AuctionState_CANCELLED},
+	gRPC.AuctionState_OPEN:      {gRPC.AuctionState_PAUSED, gRPC.AuctionState_CLOSING, gRPC.AuctionState_CANCELLED},
+	gRPC.AuctionState_PAUSED:    {gRPC.AuctionState_OPEN, gRPC.AuctionState_CLOSING, gRPC.AuctionState_CANCELLED},
+	gRPC.AuctionState_CLOSING:   {gRPC.AuctionState_CLOSED},
+	gRPC.AuctionState_CLOSED:    {gRPC.AuctionState_SETTLED},
+}
+
+// every auction by id, and the bidders an operator has banned. Guarded by auctionMu.
+var auctions = map[string]*auction{}
+var banned = map[string]bool{}
+
+// newAuction makes a DRAFT auction, use openAuction or scheduleAuction to get it going
+func newAuction(id string, reserve int64, duration time.Duration) *auction {
+	return &auction{id: id, reserve: reserve, duration: duration, created: time.Now()}
+}
+
+func stateName(state gRPC.AuctionState) string {
+	return strings.ToLower(state.String())
+}
+
+func canTransition(from gRPC.AuctionState, to gRPC.AuctionState) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// over is true once the auction no longer takes bids and never will again
+func (a *auction) over() bool {
+	switch a.state {
+	case gRPC.AuctionState_CLOSING, gRPC.AuctionState_CLOSED, gRPC.AuctionState_SETTLED, gRPC.AuctionState_CANCELLED:
+		return true
+	}
+	return false
+}
+
+// active is true while the auction is open, or paused and will open again
+func (a *auction) active() bool {
+	return a.state == gRPC.AuctionState_OPEN || a.state == gRPC.AuctionState_PAUSED
+}
+
+func (a *auction) info() *gRPC.AuctionInfo {
+	info := &gRPC.AuctionInfo{
+		Id:         a.id,
+		State:      a.state,
+		Reserve:    a.reserve,
+		DurationMs: a.duration.Milliseconds(),
+		Amount:     a.amount,
+		Bidder:     a.bidder,
+		History:    a.history,
+		Order:      a.order,
+		LastUpdate: uint64(len(a.updates)),
+	}
+	if !a.ends.IsZero() {
+		info.EndsAt = a.ends.UnixMilli()
+	}
+	if !a.startsAt.IsZero() {
+		info.StartsAt = a.startsAt.UnixMilli()
+	}
+	if a.state == gRPC.AuctionState_PAUSED {
+		info.RemainingMs = a.remaining.Milliseconds()
+	}
+	return info
+}
+
+// ListAuctions lists the auctions for bidders, drafts are left out until they are scheduled or opened
+func (s *Server) ListAuctions(ctx context.Context, request *gRPC.ListAuctionsRequest) (*gRPC.ListAuctionsResponse, error) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if !serving() {
+		return nil, notServingError()
+	}
+	response := &gRPC.ListAuctionsResponse{}
+	for _, a := range sortedAuctions() {
+		if a.state != gRPC.AuctionState_DRAFT {
+			response.Auctions = append(response.Auctions, a.info())
+		}
+	}
+	return response, nil
+}
+
+// snapshot is the info with the bids, for a replica that is catching up
+func (a *auction) snapshot() *gRPC.AuctionInfo {
+	info := a.info()
+	info.Bids = a.bids
+	info.Updates = a.updates
+	return info
+}
+
+// the auctions in the order they were created. Must be called holding auctionMu.
+func sortedAuctions() []*auction {
+	list := make([]*auction, 0, len(auctions))
+	for _, a := range auctions {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].created.Equal(list[j].created) {
+			return list[i].created.Before(list[j].created)
+		}
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// counts the open auctions for the metrics. Must be called holding auctionMu.
+func updateActiveAuctions() {
+	open := 0
+	for _, a := range auctions {
+		if a.active() {
+			open++
+		}
+	}
+	activeAuctions.Set(float64(open))
+}
+
+// transition moves the auction to another state, keeps it in the history and sends message with the
+// event to every bidder. Must be called holding auctionMu.
+func transition(ctx context.Context, a *auction, to gRPC.AuctionState, reason string, sessions *sessionHub, message *gRPC.Message) error {
+	if !canTransition(a.state, to) {
+		return status.Errorf(codes.FailedPrecondition, "auction %q is %s and can not become %s", a.id, stateName(a.state), stateName(to))
+	}
+	event := &gRPC.AuctionEvent{Auction: a.id, From: a.state, To: to, At: time.Now().UnixMilli(), Reason: reason}
+	a.state = to
+	a.history = append(a.history, event)
+	updateActiveAuctions()
+	slog.InfoContext(ctx, "auction changed state", "from", stateName(event.From), "to", stateName(to), "reason", reason)
+	webhooks.emit(WebhookEvent{
+		ID:      a.id + "/state/" + strconv.Itoa(len(a.history)),
+		Type:    "auction." + stateName(to),
+		Auction: a.id,
+		Bidder:  a.bidder,
+		Amount:  a.amount,
+		From:    stateName(event.From),
+		To:      stateName(to),
+		Reason:  reason,
+	})
+	a.addUpdate(&gRPC.AuctionUpdate{Type: "auction." + stateName(to), Bidder: a.bidder, Amount: a.amount, Event: event})
+
+	message.Sender = "Server"
+	message.Auction = a.id
+	message.Event = event
+	sessions.sendToAll(ctx, message)
+	return nil
+}
+
+func (a *auction) stopTimer() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+// startTimer closes the auction when a.ends is reached. Must be called holding auctionMu.
+func startTimer(a *auction, sessions *sessionHub) {
+	a.stopTimer()
+	a.timer = time.AfterFunc(time.Until(a.ends), func() { endAuction(a, sessions) })
+}
+
+// endAuction closes the auction if it has run out
+func endAuction(a *auction, sessions *sessionHub) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if isDraining() {
+		return // the audit log is closed, the other replicas close the auction
+	}
+	// the timer may have fired while an operator held the lock to close, pause or resume the auction
+	if a.state != gRPC.AuctionState_OPEN || time.Now().Before(a.ends) {
+		return
+	}
+
+	ctx := logging.With(context.Background(), "auction", a.id)
+	closeAuction(ctx, a, sessions)
+}
+
+// startOpenTimer opens the auction when a.startsAt is reached. Must be called holding auctionMu.
+func startOpenTimer(a *auction, sessions *sessionHub) {
+	a.stopTimer()
+	a.timer = time.AfterFunc(time.Until(a.startsAt), func() { openScheduled(a, sessions) })
+}
+
+// openScheduled opens a scheduled auction if its time has come
+func openScheduled(a *auction, sessions *sessionHub) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if isDraining() {
+		return
+	}
+	if a.state != gRPC.AuctionState_SCHEDULED || time.Now().Before(a.startsAt) {
+		return
+	}
+
+	ctx := logging.With(context.Background(), "auction", a.id)
+	openAuction(ctx, a, sessions)
+}
+
+// scheduleAuction makes a draft auction open by itself at startsAt. Must be called holding auctionMu.
+func scheduleAuction(ctx context.Context, a *auction, startsAt time.Time, sessions *sessionHub) error {
+	err := transition(ctx, a, gRPC.AuctionState_SCHEDULED, "", sessions, &gRPC.Message{
+		Message: "A new auction " + a.id + " opens at " + startsAt.Format("15:04:05") + " with a reserve price of: ",
+		Bid:     a.reserve,
+	})
+	if err != nil {
+		return err
+	}
+	a.startsAt = startsAt
+	record(ctx, audit.Entry{Event: audit.Scheduled, Auction: a.id, Reason: "opens at " + startsAt.Format(time.RFC3339)})
+	startOpenTimer(a, sessions)
+	return nil
+}
+
+// openAuction lets bids in and starts the clock, so the auction closes even if nobody bids. Must be called holding auctionMu.
+func openAuction(ctx context.Context, a *auction, sessions *sessionHub) error {
+	if a.state == gRPC.AuctionState_PAUSED {
+		return status.Errorf(codes.FailedPrecondition, "auction %q is paused, resume it instead", a.id)
+	}
+	err := transition(ctx, a, gRPC.AuctionState_OPEN, "", sessions, &gRPC.Message{
+		Message: "A new auction " + a.id + " has opened with a reserve price of: ",
+		Bid:     a.reserve,
+	})
+	if err != nil {
+		return err
+	}
+	a.ends = time.Now().Add(a.duration)
+	startTimer(a, sessions)
+	record(ctx, audit.Entry{Event: audit.Opened, Auction: a.id})
+	return nil
+}
+
+// closeAuction ends the auction, the highest bid wins. Must be called holding auctionMu.
+func closeAuction(ctx context.Context, a *auction, sessions *sessionHub) error {
+	ctx, span := tracing.Start(ctx, "close auction", tracing.Internal, "auction", a.id)
+	defer span.End(nil)
+
+	err := transition(ctx, a, gRPC.AuctionState_CLOSING, "", sessions, &gRPC.Message{
+		Message: "The auction " + a.id + " is closing, bids are no longer taken",
+	})
+	if err != nil {
+		return err
+	}
+	a.stopTimer()
+	fmt.Println("Auction " + a.id + " has ended")
+	slog.InfoContext(ctx, "auction has ended", "winner", a.bidder, "amount", a.amount)
+	record(ctx, audit.Entry{Event: audit.Closed, Auction: a.id, Bidder: a.bidder, Amount: a.amount})
+	if err := transition(ctx, a, gRPC.AuctionState_CLOSED, "", sessions, overMessage(a)); err != nil {
+		return err
+	}
+	settlement.closed(ctx, a)
+	return nil
+}
+
+// pauseAuction stops the clock of the auction and turns down bids until it is resumed. Must be called holding auctionMu.
+func pauseAuction(ctx context.Context, a *auction, sessions *sessionHub) error {
+	err := transition(ctx, a, gRPC.AuctionState_PAUSED, "", sessions, &gRPC.Message{
+		Message: "The auction " + a.id + " has been paused, bids are turned down until it resumes. The highest bid is: ",
+		Bid:     a.amount,
+	})
+	if err != nil {
+		return err
+	}
+	a.stopTimer()
+	// never zero, so a paused auction always has time left when it resumes
+	a.remaining = max(time.Until(a.ends), time.Millisecond)
+	a.ends = time.Time{}
+	record(ctx, audit.Entry{Event: audit.Paused, Auction: a.id})
+	return nil
+}
+
+// resumeAuction starts the clock again with the time that was left. Must be called holding auctionMu.
+func resumeAuction(ctx context.Context, a *auction, sessions *sessionHub) error {
+	if a.state != gRPC.AuctionState_PAUSED {
+		return status.Errorf(codes.FailedPrecondition, "auction %q is %s, not paused", a.id, stateName(a.state))
+	}
+	err := transition(ctx, a, gRPC.AuctionState_OPEN, "", sessions, &gRPC.Message{
+		Message: "The auction " + a.id + " has resumed, the highest bid is: ",
+		Bid:     a.amount,
+	})
+	if err != nil {
+		return err
+	}
+	a.ends = time.Now().Add(a.remaining)
+	a.remaining = 0
+	startTimer(a, sessions)
+	record(ctx, audit.Entry{Event: audit.Resumed, Auction: a.id})
+	return nil
+}
+
+// cancelAuction voids the auction, nobody wins and the highest bid is no longer held. Must be called holding auctionMu.
+func cancelAuction(ctx context.Context, a *auction, sessions *sessionHub, reason string) error {
+	message := &gRPC.Message{Message: "The auction " + a.id + " was cancelled, there is no winner"}
+	if err := transition(ctx, a, gRPC.AuctionState_CANCELLED, reason, sessions, message); err != nil {
+		return err
+	}
+	a.stopTimer()
+	a.remaining = 0
+	bidders.release(a.bidder, a.id)
+	fmt.Println("Auction " + a.id + " was cancelled")
+	record(ctx, audit.Entry{Event: audit.Cancelled, Auction: a.id, Reason: reason})
+	return nil
+}
+
+// what bidders are told about an auction that is over
+func overMessage(a *auction) *gRPC.Message {
+	if a.state == gRPC.AuctionState_CANCELLED {
+		return &gRPC.Message{
+			Sender:  "Server",
+			Message: "The auction " + a.id + " was cancelled, there is no winner",
+			Auction: a.id,
+		}
+	}
+	return &gRPC.Message{
+		Sender:  "Server",
+		Message: "The auction is over, and was won by " + a.bidder + " at the price: ",
+		Bid:     a.amount,
+		Auction: a.id,
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+)
+
+func TestCanTransition(t *testing.T) {
+	const (
+		draft     = gRPC.AuctionState_DRAFT
+		scheduled = gRPC.AuctionState_SCHEDULED
+		open      = gRPC.AuctionState_OPEN
+		paused    = gRPC.AuctionState_PAUSED
+		closing   = gRPC.AuctionState_CLOSING
+		closed    = gRPC.AuctionState_CLOSED
+		settled   = gRPC.AuctionState_SETTLED
+		cancelled = gRPC.AuctionState_CANCELLED
+	)
+	// every change of state that is allowed, all others are not
+	allowed := map[[2]gRPC.AuctionState]bool{
+		{draft, scheduled}: true, {draft, open}: true, {draft, cancelled}: true,
+		{scheduled, open}: true, {scheduled, cancelled}: true,
+		{open, paused}: true, {open, closing}: true, {open, cancelled}: true,
+		{paused, open}: true, {paused, closing}: true, {paused, cancelled}: true,
+		{closing, closed}: true,
+		{closed, settled}: true,
+	}
+	states := []gRPC.AuctionState{draft, scheduled, open, paused, closing, closed, settled, cancelled}
+	for _, from := range states {
+		for _, to := range states {
+			if got, want := canTransition(from, to), allowed[[2]gRPC.AuctionState{from, to}]; got != want {
+				t.Errorf("canTransition(%v, %v) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestOver(t *testing.T) {
+	tests := []struct {
+		state  gRPC.AuctionState
+		over   bool
+		active bool
+	}{
+		{gRPC.AuctionState_DRAFT, false, false},
+		{gRPC.AuctionState_SCHEDULED, false, false},
+		{gRPC.AuctionState_OPEN, false, true},
+		{gRPC.AuctionState_PAUSED, false, true},
+		{gRPC.AuctionState_CLOSING, true, false},
+		{gRPC.AuctionState_CLOSED, true, false},
+		{gRPC.AuctionState_SETTLED, true, false},
+		{gRPC.AuctionState_CANCELLED, true, false},
+	}
+	for _, test := range tests {
+		a := &auction{state: test.state}
+		if a.over() != test.over || a.active() != test.active {
+			t.Errorf("%v: over() = %v, active() = %v, want %v, %v", test.state, a.over(), a.active(), test.over, test.active)
+		}
+	}
+}
+
+// the clock of an auction starts when it opens, not with the first bid, and stops while it is paused
+func TestAuctionClock(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	oldLog := auditLog
+	auditLog = log
+	defer func() { auditLog = oldLog }()
+
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	ctx := context.Background()
+	sessions := newSessionHub()
+	a := newAuction("clock", 0, time.Hour)
+	defer a.stopTimer()
+
+	if err := openAuction(ctx, a, sessions); err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(a.ends); a.timer == nil || left < 59*time.Minute || left > time.Hour {
+		t.Fatalf("after opening the auction ends in %v, want an hour", left)
+	}
+
+	a.ends = time.Now().Add(30 * time.Minute)
+	if err := pauseAuction(ctx, a, sessions); err != nil {
+		t.Fatal(err)
+	}
+	if !a.ends.IsZero() || a.remaining < 29*time.Minute || a.remaining > 30*time.Minute {
+		t.Fatalf("after pausing ends = %v and %v is left, want no end and 30m left", a.ends, a.remaining)
+	}
+
+	if err := resumeAuction(ctx, a, sessions); err != nil {
+		t.Fatal(err)
+	}
+	if left := time.Until(a.ends); a.remaining != 0 || left < 29*time.Minute || left > 30*time.Minute {
+		t.Fatalf("after resuming the auction ends in %v, want 30m", left)
+	}
+}
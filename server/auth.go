@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// the bidder API, the only service that is rate limited
+const bidderPrefix = "/proto.AuctionSystem/"
+
+// methods that can be called without a token
+var publicMethods = map[string]bool{
+	bidderPrefix + "Login": true,
+}
+
+// services that can be called without a bidder token, the replica service checks the callers certificate
+// and the admin service the admin token instead
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+	"/proto.Replica/",
+	adminPrefix,
+}
+
+func isPublic(method string) bool {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return publicMethods[method]
+}
+
+var errInvalidToken = errors.New("invalid token")
+var errExpiredToken = errors.New("token has expired")
+
+// the header of every token we issue, tokens are HS256 JWTs
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type bidderKey struct{}
+
+// authenticator issues and verifies the tokens bidders use after logging in.
+// All replicas have to be started with the same key, so a token from one replica is accepted by the others.
+type authenticator struct {
+	key []byte
+	ttl time.Duration
+}
+
+// reads the signing key from a file, ex. one made with "openssl rand -hex 32 > auth.key"
+func loadAuthenticator(path string, ttl time.Duration) (*authenticator, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) < 16 {
+		return nil, errors.New("auth key must be at least 16 bytes")
+	}
+	return &authenticator{key: key, ttl: ttl}, nil
+}
+
+func (a *authenticator) sign(data string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue makes a token for the bidder which expires after the authenticators ttl
+func (a *authenticator) issue(name string) (string, time.Time) {
+	now := time.Now()
+	expires := now.Add(a.ttl)
+	claims, _ := json.Marshal(tokenClaims{Subject: name, IssuedAt: now.Unix(), ExpiresAt: expires.Unix()})
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + a.sign(unsigned), expires
+}
+
+// verify checks the signature and expiry of a token and returns the bidder it was issued to
+func (a *authenticator) verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return "", errInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(a.sign(parts[0]+"."+parts[1]))) {
+		return "", errInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Subject == "" {
+		return "", errInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", errExpiredToken
+	}
+	return claims.Subject, nil
+}
+
+// authenticate finds the bearer token in the metadata of ctx and returns a context carrying the bidders name
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	name, err := a.verify(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, bidderKey{}, name), nil
+}
+
+func (a *authenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if isPublic(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if isPublic(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	ctx, err := a.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// checkBidder makes sure the name a bidder claims is the one they logged in as.
+// It always succeeds when authentication is turned off.
+func checkBidder(ctx context.Context, claimed string) error {
+	name, ok := ctx.Value(bidderKey{}).(string)
+	if !ok || name == claimed {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "logged in as %s, not %s", name, claimed)
+}
+
+func (s *Server) Login(ctx context.Context, request *gRPC.LoginRequest) (*gRPC.LoginResponse, error) {
+	if auth == nil {
+		return nil, status.Error(codes.Unimplemented, "authentication is not enabled on this server")
+	}
+	if isBanned(request.Name) {
+		return nil, bannedError()
+	}
+	if err := bidders.checkPassword(request.Name, request.Password); err != nil {
+		slog.WarnContext(ctx, "failed login", "bidder", request.Name, "err", err)
+		return nil, status.Error(codes.Unauthenticated, "wrong name or password")
+	}
+
+	token, expires := auth.issue(request.Name)
+	slog.InfoContext(ctx, "logged in", "bidder", request.Name)
+	return &gRPC.LoginResponse{Token: token, ExpiresAt: expires.Unix()}, nil
+}
+
+// hashes a password for the "password_hash" field of the bidders file, which never holds the password itself
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errUnknownBidder = errors.New("bidder is not registered")
+var errCreditExceeded = errors.New("bid exceeds available credit")
+var errWrongPassword = errors.New("wrong password")
+
+// Bidder is a registered bidder and the credit they are allowed to commit.
+type Bidder struct {
+	Name         string `json:"name"`
+	Limit        int64  `json:"limit"`
+	PasswordHash string `json:"password_hash"` // bcrypt hash, only needed when authentication is enabled
+
+	holds map[string]int64 // auction -> amount held by the bidder's leading bid, so their exposure can be summed across auctions
+}
+
+// committed returns the funds the bidder has tied up in auctions other than skip.
+func (b *Bidder) committed(skip string) int64 {
+	var total int64
+	for auction, amount := range b.holds {
+		if auction != skip {
+			total += amount
+		}
+	}
+	return total
+}
+
+// bidderRegistry keeps track of who may bid and how much of their limit is in use.
+// A nil registry means no registry was configured, and anyone can bid any amount.
+type bidderRegistry struct {
+	mu      sync.Mutex
+	bidders map[string]*Bidder
+}
+
+// loads the registry from a json file containing a list of bidders, ex.
+// [{"name": "alice", "limit": 500}, {"name": "bob", "limit": 1000}]
+func loadBidders(path string) (*bidderRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Bidder
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	registry := &bidderRegistry{bidders: make(map[string]*Bidder)}
+	for _, bidder := range list {
+		bidder.holds = make(map[string]int64)
+		registry.bidders[bidder.Name] = bidder
+	}
+	return registry, nil
+}
+
+// checkPassword compares password against the bcrypt hash stored for the bidder
+func (r *bidderRegistry) checkPassword(name string, password string) error {
+	if r == nil {
+		return errUnknownBidder
+	}
+	r.mu.Lock()
+	bidder, ok := r.bidders[name]
+	r.mu.Unlock()
+	if !ok {
+		return errUnknownBidder
+	}
+	if bidder.PasswordHash == "" {
+		return errWrongPassword
+	}
+	if bcrypt.CompareHashAndPassword([]byte(bidder.PasswordHash), []byte(password)) != nil {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// reserve holds amount of the bidder's credit for their bid in auction.
+// A bidder raising their own leading bid only needs credit for the new amount.
+// On failure the returned value is the credit the bidder still has available.
+func (r *bidderRegistry) reserve(name string, auction string, amount int64) (int64, error) {
+	if r == nil {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bidder, ok := r.bidders[name]
+	if !ok {
+		return 0, errUnknownBidder
+	}
+
+	available := bidder.Limit - bidder.committed(auction)
+	if amount > available {
+		return available, errCreditExceeded
+	}
+	bidder.holds[auction] = amount
+	return available - amount, nil
+}
+
+// release frees the funds the bidder had held in auction, ex. when they are outbid.
+func (r *bidderRegistry) release(name string, auction string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bidder, ok := r.bidders[name]; ok {
+		delete(bidder.holds, auction)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// a cluster of three replicas running as their own processes, for the tests of what the cluster must do once
+type testCluster struct {
+	addrs   []string // the addresses to dial the replicas on
+	conns   []*grpc.ClientConn
+	metrics []string // the urls of their metrics
+	procs   []*exec.Cmd
+}
+
+// freePorts finds n ports nothing listens on
+func freePorts(t *testing.T, n int) []int {
+	var ports []int
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports
+}
+
+// startCluster builds the server and starts three replicas that listen on and know each other by addresses of
+// different forms, like 0.0.0.0:5000 listening while the peers dial localhost:5000. It waits until they all serve.
+func startCluster(t *testing.T, args ...string) *testCluster {
+	if testing.Short() {
+		t.Skip("starts three replicas")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "server")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	ports := freePorts(t, 6)
+	p := func(i int) string { return fmt.Sprint(ports[i]) }
+	replicas := []struct{ listen, peers string }{
+		{"0.0.0.0:" + p(0), "localhost:" + p(1) + ",127.0.0.1:" + p(2)},
+		{":" + p(1), "127.0.0.1:" + p(0) + ",localhost:" + p(2)},
+		{"127.0.0.1:" + p(2), "localhost:" + p(0) + ",127.0.0.1:" + p(1)},
+	}
+	c := &testCluster{}
+	for i, r := range replicas {
+		data := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.Mkdir(data, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(bin, append([]string{
+			"-replica", fmt.Sprint(i), "-listen", r.listen, "-peers", r.peers, "-data-dir", data,
+			"-metrics", "127.0.0.1:" + p(3+i), "-recovery-timeout", "1s", "-log-level", "debug",
+		}, args...)...)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+			if t.Failed() {
+				log, _ := os.ReadFile(filepath.Join(data, "log.txt"))
+				t.Logf("log of replica %s:\n%s", filepath.Base(data), log)
+			}
+		})
+
+		addr := "127.0.0.1:" + p(i)
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		c.addrs = append(c.addrs, addr)
+		c.conns = append(c.conns, conn)
+		c.metrics = append(c.metrics, "http://127.0.0.1:"+p(3+i)+"/metrics")
+		c.procs = append(c.procs, cmd)
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for i, conn := range c.conns {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: auctionService})
+			cancel()
+			if err == nil && response.Status == healthpb.HealthCheckResponse_SERVING {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("replica %d is not serving: %v", i, err)
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+	return c
+}
+
+// publish sends the message to every replica, like the client does
+func (c *testCluster) publish(t *testing.T, message *gRPC.Message) {
+	for i, conn := range c.conns {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		response, err := gRPC.NewAuctionSystemClient(conn).Publish(ctx, message)
+		cancel()
+		if err != nil {
+			t.Fatalf("replica %d: %v", i, err)
+		}
+		if response.Outcome != outcomeAccepted {
+			t.Fatalf("replica %d: outcome %q, want %q", i, response.Outcome, outcomeAccepted)
+		}
+	}
+}
+
+// metric reads a metric of replica i, ex. `auction_peer_up{peer="localhost:5001"}`, "" if it has not got it
+func (c *testCluster) metric(t *testing.T, i int, name string) string {
+	response, err := http.Get(c.metrics[i])
+	if err != nil {
+		t.Fatalf("replica %d: %v", i, err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, name+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// waitForMetric waits until the metric of replica i has the value want, and returns the value it has
+func (c *testCluster) waitForMetric(t *testing.T, i int, name, want string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		got := c.metric(t, i, name)
+		if got == want || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// counter counts the requests it gets, by a key taken from each
+type counter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCounter(t *testing.T, key func(r *http.Request) string) (*counter, string) {
+	c := &counter{counts: map[string]int{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		c.counts[key(r)]++
+		c.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return c, server.URL
+}
+
+func (c *counter) get(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[key]
+}
+
+// waitFor waits until the count of key is at least want, and then a little longer for any that come after
+func (c *counter) waitFor(key string, want int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for c.get(key) < want && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(2 * time.Second)
+	return c.get(key)
+}
+
+func TestClusterSendsWebhooksOnce(t *testing.T) {
+	events, url := newCounter(t, func(r *http.Request) string { return r.Header.Get("X-Auction-Event-Id") })
+	subscriptions, _ := json.Marshal([]map[string]interface{}{{"url": url, "secret": strings.Repeat("s", 16), "events": []string{"bid.accepted"}}})
+	file := filepath.Join(t.TempDir(), "webhooks.json")
+	if err := os.WriteFile(file, subscriptions, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startCluster(t, "-webhooks", file, "-auction-duration", "1m")
+	// the replicas decide who sends once a second, after they have heard from their peers
+	time.Sleep(2 * time.Second)
+	c.publish(t, &gRPC.Message{Sender: "alice", Message: "bid", Bid: 10})
+
+	id := defaultAuction + "/bid/1"
+	if got := events.waitFor(id, 1, 10*time.Second); got != 1 {
+		t.Errorf("event %s was posted %d times, want once", id, got)
+	}
+}
+
+func TestClusterMetrics(t *testing.T) {
+	c := startCluster(t, "-auction-duration", "1m")
+
+	// a bid that replica 1 does not get puts it one update behind the others
+	for _, i := range []int{0, 2} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := gRPC.NewAuctionSystemClient(c.conns[i]).Publish(ctx, &gRPC.Message{Sender: "alice", Message: "bid", Bid: 10})
+		cancel()
+		if err != nil {
+			t.Fatalf("replica %d: %v", i, err)
+		}
+	}
+	// replica 0 knows replica 1 as localhost and replica 2 as 127.0.0.1
+	behind := fmt.Sprintf("auction_replication_lag{peer=%q}", strings.Replace(c.addrs[1], "127.0.0.1", "localhost", 1))
+	if got := c.waitForMetric(t, 0, behind, "1", 2*lagInterval); got != "1" {
+		t.Errorf("%s = %q, want 1", behind, got)
+	}
+	caughtUp := fmt.Sprintf("auction_replication_lag{peer=%q}", c.addrs[2])
+	if got := c.metric(t, 0, caughtUp); got != "0" {
+		t.Errorf("%s = %q, want 0", caughtUp, got)
+	}
+
+	if got := c.metric(t, 1, "auction_leader_changes_total"); got != "" && got != "0" {
+		t.Errorf("auction_leader_changes_total = %s before replica 0 stopped, want 0", got)
+	}
+	c.procs[0].Process.Kill()
+	if got := c.waitForMetric(t, 1, "auction_leader_changes_total", "1", 10*time.Second); got != "1" {
+		t.Errorf("auction_leader_changes_total = %q after replica 0 stopped, want 1", got)
+	}
+}
+
+func TestClusterHandsOverOnShutdown(t *testing.T) {
+	events, url := newCounter(t, func(r *http.Request) string { return r.Header.Get("X-Auction-Event-Id") })
+	subscriptions, _ := json.Marshal([]map[string]interface{}{{"url": url, "secret": strings.Repeat("s", 16), "events": []string{"bid.accepted"}}})
+	file := filepath.Join(t.TempDir(), "webhooks.json")
+	if err := os.WriteFile(file, subscriptions, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := startCluster(t, "-webhooks", file, "-auction-duration", "1m")
+	time.Sleep(2 * time.Second)
+	// replica 0 sends the webhooks until it shuts down
+	c.procs[0].Process.Signal(syscall.SIGTERM)
+	if err := c.procs[0].Wait(); err != nil {
+		t.Fatalf("replica 0 did not shut down cleanly: %v", err)
+	}
+	time.Sleep(time.Second)
+
+	for _, i := range []int{1, 2} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		response, err := gRPC.NewAuctionSystemClient(c.conns[i]).Publish(ctx, &gRPC.Message{Sender: "alice", Message: "bid", Bid: 10})
+		cancel()
+		if err != nil {
+			t.Fatalf("replica %d: %v", i, err)
+		}
+		if response.Outcome != outcomeAccepted {
+			t.Fatalf("replica %d: outcome %q, want %q", i, response.Outcome, outcomeAccepted)
+		}
+	}
+	if got := events.waitFor(defaultAuction+"/bid/1", 1, 5*time.Second); got != 1 {
+		t.Errorf("event posted %d times after replica 0 left, want 1", got)
+	}
+}
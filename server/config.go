@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// every setting of the server is a flag. Settings not given as flags are taken from the environment,
+// and then from the -config file, so flags win over the environment, which wins over the file.
+var configFile = flag.String("config", "", "yaml file with settings, keyed by flag name, ex. \"log-level: debug\" (env AUCTION_CONFIG)")
+
+// flags that make no sense in a config file
+var commandLineOnly = map[string]bool{"config": true, "hash-password": true}
+
+// envName is the environment variable for a flag, ex. AUCTION_TLS_CERT for -tls-cert
+func envName(flagName string) string {
+	return "AUCTION_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig sets every flag of fs that was not given on the command line from the environment or
+// the config file. The replica number can still be given after the flags, ex. "-bidders bidders.json 0".
+func loadConfig(fs *flag.FlagSet) error {
+	if fs.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments %v, flags have to come before the replica number", fs.Args()[1:])
+	}
+	if fs.NArg() == 1 {
+		given := false
+		fs.Visit(func(f *flag.Flag) { given = given || f.Name == "replica" })
+		if replica := fs.Lookup("replica").Value.String(); given && fs.Arg(0) != replica {
+			return fmt.Errorf("replica given both as -replica %s and as %s", replica, fs.Arg(0))
+		}
+		if err := fs.Set("replica", fs.Arg(0)); err != nil {
+			return fmt.Errorf("replica number %q: %v", fs.Arg(0), err)
+		}
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+	settings := map[string]string{}
+	if path != "" {
+		var err error
+		if settings, err = readConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil || commandLineOnly[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || commandLineOnly[f.Name] {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("$%s: invalid value %q: %v", envName(f.Name), value, err))
+			}
+		} else if value, ok := settings[f.Name]; ok {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q for %s: %v", path, value, f.Name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// reads a yaml config file into flag names and values. Sections are joined to the names of
+// the settings in them with a "-", so "tls: {cert: a.pem}" is the same as "tls-cert: a.pem",
+// and lists are joined with commas, ex. "peers: [localhost:5001, localhost:5002]".
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	settings := map[string]string{}
+	flatten("", doc, settings)
+	return settings, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, settings map[string]string) {
+	for key, value := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(name, v, settings)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			settings[name] = strings.Join(items, ",")
+		case nil:
+			settings[name] = ""
+		default:
+			settings[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// fills in the settings that default to something based on the replica number
+func applyDefaults() {
+	replicaID = strconv.Itoa(*replicaFlag)
+	if *listenAddr == "" {
+		*listenAddr = "localhost:" + strconv.Itoa(5000+*replicaFlag)
+	}
+	if *metricsAddr == "" {
+		*metricsAddr = "localhost:" + strconv.Itoa(9000+*replicaFlag)
+	}
+	if *settleDeadLetter == "" {
+		*settleDeadLetter = filepath.Join(*dataDir, "settle-dead-"+replicaID+".jsonl")
+	}
+	if *webhookDeadLetter == "" {
+		*webhookDeadLetter = filepath.Join(*dataDir, "webhooks-dead-"+replicaID+".jsonl")
+	}
+	if *auditLogFile == "" {
+		*auditLogFile = filepath.Join(*dataDir, "audit-"+replicaID+".log")
+	}
+	if *logOutput == "" {
+		*logOutput = filepath.Join(*dataDir, "log.txt")
+	}
+}
+
+// validateConfig checks the settings go together, and returns everything that is wrong with them at once
+func validateConfig() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(*replicaFlag >= 0, "the replica number is missing, give it with -replica or after the flags")
+	if _, _, err := net.SplitHostPort(*listenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %v", err))
+	}
+	if *peerAddrs != "" {
+		for _, addr := range strings.Split(*peerAddrs, ",") {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				errs = append(errs, fmt.Errorf("peers: %v", err))
+			}
+			check(addr != *listenAddr, "peers: %s is this replica's own address", addr)
+		}
+	}
+	if *trustedGateway != "" {
+		for _, ip := range strings.Split(*trustedGateway, ",") {
+			check(net.ParseIP(ip) != nil, "trusted-gateway: %q is not an IP address", ip)
+		}
+	}
+	if info, err := os.Stat(*dataDir); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("data-dir: %s is not a directory", *dataDir))
+	}
+
+	check((*tlsCertFile == "") == (*tlsKeyFile == ""), "tls-cert and tls-key have to be given together")
+	check(*tlsCAFile == "" || *tlsCertFile != "", "tls-ca needs tls-cert")
+	check(*authKeyFile == "" || *biddersFile != "", "auth-key needs bidders, authentication checks passwords against the bidders file")
+
+	check(*auctionDuration > 0, "auction-duration must be positive")
+	check(*tokenTTL > 0, "token-ttl must be positive")
+	check(*settleLease > 0, "settle-lease must be positive")
+	check(*settleAttempts >= 1, "settle-attempts must be at least 1")
+	check(*webhookAttempts >= 1, "webhook-attempts must be at least 1")
+	check(*webhookHandover >= 0, "webhook-handover must not be negative")
+	if *settleWebhook != "" {
+		u, err := url.Parse(*settleWebhook)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "settle-webhook must be an http or https url")
+	}
+	check(*recoveryTimeout >= 0, "recovery-timeout must not be negative")
+	check(*shutdownTimeout >= 0, "shutdown-timeout must not be negative")
+	check(*retractWindow >= 0 && *retractCutoff >= 0, "retract-window and retract-cutoff must not be negative")
+	check(*bidRate >= 0 && *globalRate >= 0, "rate and global-rate must not be negative")
+	check(*bidRate == 0 || *bidBurst >= 1, "burst must be at least 1")
+	check(*globalRate == 0 || *globalBurst >= 1, "global-burst must be at least 1")
+	return errors.Join(errs...)
+}
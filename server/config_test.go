@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{"log-level": "info", "peers": "", "replica": "-1"},
+		},
+		{
+			name: "flag wins over env and file",
+			args: []string{"-log-level", "debug"},
+			env:  map[string]string{"AUCTION_LOG_LEVEL": "warn"},
+			file: "log-level: error\n",
+			want: map[string]string{"log-level": "debug"},
+		},
+		{
+			name: "env wins over file",
+			env:  map[string]string{"AUCTION_LOG_LEVEL": "warn"},
+			file: "log-level: error\n",
+			want: map[string]string{"log-level": "warn"},
+		},
+		{
+			name: "file",
+			file: "log-level: error\ntls:\n  cert: a.pem\npeers: [localhost:5001, localhost:5002]\n",
+			want: map[string]string{"log-level": "error", "tls-cert": "a.pem", "peers": "localhost:5001,localhost:5002"},
+		},
+		{
+			name: "replica after the flags",
+			args: []string{"-log-level", "debug", "2"},
+			want: map[string]string{"replica": "2"},
+		},
+		{
+			name:    "replica twice",
+			args:    []string{"-replica", "1", "2"},
+			wantErr: "replica given both",
+		},
+		{
+			name:    "unknown setting",
+			file:    "colour: blue\n",
+			wantErr: `unknown setting "colour"`,
+		},
+		{
+			name:    "command line only",
+			file:    "hash-password: secret\n",
+			wantErr: `unknown setting "hash-password"`,
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"AUCTION_RATE": "fast"},
+			wantErr: "$AUCTION_RATE: invalid value",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("server", flag.ContinueOnError)
+			fs.String("config", "", "")
+			fs.String("hash-password", "", "")
+			fs.Int("replica", -1, "")
+			fs.String("log-level", "info", "")
+			fs.String("peers", "", "")
+			fs.String("tls-cert", "", "")
+			fs.Float64("rate", 5, "")
+
+			args := test.args
+			if test.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(test.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := loadConfig(fs)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("loadConfig() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			for name, want := range test.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
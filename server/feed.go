@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Every bid, retraction and change of state of an auction is kept as an update, numbered from 1 for each
+// auction. The replicas get the same messages in the same order, so they number the updates the same, and
+// a watcher that loses its replica can go on from the last update it has with another one.
+
+// addUpdate numbers the update, keeps it and wakes up the watchers of the auction. Must be called holding auctionMu.
+func (a *auction) addUpdate(update *gRPC.AuctionUpdate) {
+	update.Sequence = uint64(len(a.updates) + 1)
+	update.Auction = a.id
+	update.At = time.Now().UnixMilli()
+	update.Highest, update.HighestBidder = a.amount, a.bidder
+	a.updates = append(a.updates, update)
+	if a.changed != nil {
+		close(a.changed)
+		a.changed = nil
+	}
+}
+
+// changes returns a channel that is closed on the next update. Must be called holding auctionMu.
+func (a *auction) changes() chan struct{} {
+	if a.changed == nil {
+		a.changed = make(chan struct{})
+	}
+	return a.changed
+}
+
+// Watch sends the updates of the auction after request.AfterSequence, and then every new one as it happens.
+func (s *Server) Watch(request *gRPC.WatchRequest, stream gRPC.AuctionSystem_WatchServer) error {
+	if request.AuctionId == "" {
+		request.AuctionId = defaultAuction
+	}
+	ctx := logging.With(stream.Context(), "auction", request.AuctionId)
+	after := request.AfterSequence
+	slog.InfoContext(ctx, "watching", "after", after)
+	watchers.Add(1)
+	defer watchers.Add(-1)
+
+	for {
+		// a replica that is catching up or has lost its quorum could miss updates, the watcher has to go elsewhere
+		if !serving() {
+			return notServingError()
+		}
+		auctionMu.Lock()
+		a, ok := auctions[request.AuctionId]
+		if !ok {
+			auctionMu.Unlock()
+			return status.Errorf(codes.NotFound, "there is no auction %q", request.AuctionId)
+		}
+		// the watcher may be ahead if it came from a replica that got a bid before this one, then it waits
+		var pending []*gRPC.AuctionUpdate
+		if after < uint64(len(a.updates)) {
+			pending = a.updates[after:]
+		}
+		changed := a.changes()
+		auctionMu.Unlock()
+
+		// updates are not changed once added, so they can be sent without the lock
+		for _, update := range pending {
+			if err := stream.Send(update); err != nil {
+				slog.InfoContext(ctx, "watcher gone", "err", err)
+				return err
+			}
+			after = update.Sequence
+		}
+
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-goingAway:
+			return status.Error(codes.Unavailable, "server going away")
+		case <-stream.Context().Done():
+			slog.InfoContext(ctx, "stopped watching", "after", after)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// the names the replica reports its health under with grpc.health.v1.
+// replicaService is SERVING once the replica has caught up with its peers, and is what the peers count for a quorum.
+// "" and auctionService are SERVING when the replica has caught up and it and its live peers are a majority of the cluster,
+// those are the ones clients should look at.
+const (
+	auctionService = "proto.AuctionSystem"
+	replicaService = "proto.Replica"
+)
+
+var healthServer = health.NewServer()
+
+var healthMu sync.Mutex
+var recovering = true             // true until the replica has caught up with its peers
+var draining = false              // true once the replica is shutting down
+var livePeers = map[string]bool{} // peers that report replicaService as SERVING
+var heardFrom = map[string]bool{} // peers whose health is known, because they answered or could not be reached
+var peerIDs = map[string]int{}    // the -replica numbers of the peers, by the address in -peers
+var everLive = map[string]bool{}  // peers that have been live since this replica started
+var leader = -1                   // the lowest -replica number among this replica and its live peers, -1 until every peer is heard from
+
+// how often the peers are asked how many updates they have, for the replication lag
+const lagInterval = 5 * time.Second
+
+// recomputes the health of the replica, must be called whenever recovering, draining or livePeers change
+func updateHealth() {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	alive := 1
+	for _, up := range livePeers {
+		if up {
+			alive++
+		}
+	}
+	quorum := alive >= (len(livePeers)+1)/2+1
+
+	replica, auction := healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_SERVING
+	if recovering || draining {
+		replica = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	if recovering || draining || !quorum {
+		auction = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	healthServer.SetServingStatus(replicaService, replica)
+	healthServer.SetServingStatus(auctionService, auction)
+	healthServer.SetServingStatus("", auction)
+	updateLeader()
+	slog.Debug("health updated", "recovering", recovering, "draining", draining, "alive", alive, "serving", auction.String())
+}
+
+// updateLeader counts the times the replica that comes first changes. A peer that is live for the first time,
+// ex. because the replicas were started together, takes over without it being counted. Must be called holding
+// healthMu.
+func updateLeader() {
+	lowest, joined := *replicaFlag, false
+	for addr, live := range livePeers {
+		if !heardFrom[addr] {
+			// until then a peer with a lower number may be up without this replica knowing
+			return
+		}
+		if live && peerIDs[addr] < lowest {
+			lowest, joined = peerIDs[addr], !everLive[addr]
+		}
+	}
+	for addr, live := range livePeers {
+		if live {
+			everLive[addr] = true
+		}
+	}
+	if leader != -1 && leader != lowest && !joined {
+		leaderChanges.Inc()
+		slog.Info("first replica changed", "from", leader, "to", lowest)
+	}
+	leader = lowest
+}
+
+// serving reports if the replica may take bids
+func serving() bool {
+	response, _ := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: auctionService})
+	return response.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
+
+// firstLive reports if this replica has the lowest -replica number among itself and its live peers, which makes
+// it the one to do what must only be done once in the cluster. The numbers are compared rather than the addresses,
+// as a replica may listen on ex. 0.0.0.0:5000 while its peers know it as localhost:5000.
+func firstLive() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	for addr, live := range livePeers {
+		if live && peerIDs[addr] < *replicaFlag {
+			return false
+		}
+	}
+	return true
+}
+
+// peersKnown reports if the health of every peer is known. Until then a peer with a lower address may be up
+// without this replica knowing, so firstLive can not be trusted yet.
+func peersKnown() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	for addr := range livePeers {
+		if !heardFrom[addr] {
+			return false
+		}
+	}
+	return true
+}
+
+// isDraining reports if the replica is shutting down
+func isDraining() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return draining
+}
+
+func notServingError() error {
+	return status.Error(codes.Unavailable, "this replica is recovering, shutting down or has lost its quorum, try another one")
+}
+
+// identifyPeer asks the peer for its -replica number and how many updates it has. Two replicas with the same
+// number would both think they come first, so the replica stops if a peer has its own number or the number of
+// another peer.
+func identifyPeer(addr string, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := gRPC.NewReplicaClient(conn).Identify(ctx, &gRPC.IdentifyRequest{Replica: int32(*replicaFlag)})
+	if status.Code(err) == codes.FailedPrecondition {
+		logging.Fatal("a peer has the same replica number", "peer", addr, "replica", *replicaFlag, "err", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if own := updateCount(); own > response.Updates {
+		replicationLag.Set(float64(own-response.Updates), addr)
+	} else {
+		replicationLag.Set(0, addr)
+	}
+
+	id := int(response.Replica)
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	for other, otherID := range peerIDs {
+		if other != addr && otherID == id {
+			logging.Fatal("two peers have the same replica number", "peer", addr, "other_peer", other, "peer_replica", id)
+		}
+	}
+	if peerIDs[addr] != id || !heardFrom[addr] {
+		slog.Info("identified peer", "peer", addr, "peer_replica", id)
+	}
+	peerIDs[addr] = id
+	updateLeader()
+	return nil
+}
+
+// keeps livePeers up to date with the health the peer reports. The peer is identified every time the
+// connection is made again, in case it was restarted with another number, and every lagInterval while it is
+// connected to measure the replication lag.
+func watchPeerHealth(addr string, conn *grpc.ClientConn) {
+	client := healthpb.NewHealthClient(conn)
+	setLive := func(up bool) {
+		healthMu.Lock()
+		changed := livePeers[addr] != up
+		livePeers[addr] = up
+		heardFrom[addr] = true
+		healthMu.Unlock()
+		if changed {
+			slog.Info("peer health changed", "peer", addr, "live", up)
+			updateHealth()
+		}
+	}
+
+	for {
+		err := identifyPeer(addr, conn)
+		ctx, cancel := context.WithCancel(context.Background())
+		var stream healthpb.Health_WatchClient
+		if err == nil {
+			stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{Service: replicaService})
+		}
+		if err == nil {
+			go measureLag(ctx, addr, conn)
+		}
+		for err == nil {
+			var response *healthpb.HealthCheckResponse
+			response, err = stream.Recv()
+			if err == nil {
+				setLive(response.Status == healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+		cancel()
+		setLive(false)
+		time.Sleep(time.Second)
+	}
+}
+
+// identifies the peer every lagInterval until ctx is done, which keeps its replication lag up to date
+func measureLag(ctx context.Context, addr string, conn *grpc.ClientConn) {
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := identifyPeer(addr, conn); err != nil {
+				slog.Debug("could not measure the replication lag", "peer", addr, "err", err)
+			}
+		}
+	}
+}
+
+// updateCount is how many updates this replica has, over every auction
+func updateCount() uint64 {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	var count uint64
+	for _, a := range auctions {
+		count += uint64(len(a.updates))
+	}
+	return count
+}
+
+// recoverState catches up with the peers after a (re)start, by copying the state of the auction
+// from the first peer that has caught up itself. If no peer has within -recovery-timeout, ex. because
+// all replicas were started together, the replica starts with an empty auction.
+func recoverState(peers map[string]*grpc.ClientConn, sessions *sessionHub) {
+	defer func() {
+		healthMu.Lock()
+		recovering = false
+		healthMu.Unlock()
+		updateHealth()
+	}()
+
+	deadline := time.Now().Add(*recoveryTimeout)
+	for len(peers) > 0 && time.Now().Before(deadline) {
+		for addr, conn := range peers {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			state, err := gRPC.NewReplicaClient(conn).GetState(ctx, &gRPC.StateRequest{})
+			cancel()
+			if err != nil {
+				slog.Debug("peer cannot give its state yet", "peer", addr, "err", err)
+				continue
+			}
+			applyState(state, sessions)
+			slog.Info("recovered state from peer", "peer", addr, "peer_replica", state.ReplicaId, "auctions", len(state.Auctions), "banned", len(state.Banned))
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	slog.Info("no peer to recover from, starting a new auction")
+}
+
+// takes over the auctions and bans a peer sent
+func applyState(state *gRPC.Snapshot, sessions *sessionHub) {
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+
+	// the auctions this replica started with are replaced, their timers must not close them
+	for _, a := range auctions {
+		a.stopTimer()
+	}
+	auctions = map[string]*auction{}
+	for i, info := range state.Auctions {
+		a := &auction{
+			id:        info.Id,
+			reserve:   info.Reserve,
+			duration:  time.Duration(info.DurationMs) * time.Millisecond,
+			created:   time.Now().Add(time.Duration(i) * time.Nanosecond), // keeps the order of the peer
+			amount:    info.Amount,
+			bidder:    info.Bidder,
+			state:     info.State,
+			history:   info.History,
+			bids:      info.Bids,
+			order:     info.Order,
+			updates:   info.Updates,
+			remaining: time.Duration(info.RemainingMs) * time.Millisecond,
+		}
+		auctions[a.id] = a
+		if a.bidder != "" && a.state != gRPC.AuctionState_CANCELLED {
+			if _, err := bidders.reserve(a.bidder, a.id, a.amount); err != nil {
+				slog.Warn("could not hold the highest bid of the recovered state", "auction", a.id, "bidder", a.bidder, "err", err)
+			}
+		}
+		if info.StartsAt != 0 {
+			a.startsAt = time.UnixMilli(info.StartsAt)
+		}
+		if info.EndsAt != 0 {
+			a.ends = time.UnixMilli(info.EndsAt)
+		}
+		switch {
+		case a.state == gRPC.AuctionState_SCHEDULED:
+			startOpenTimer(a, sessions)
+		case a.state == gRPC.AuctionState_OPEN && !a.ends.IsZero():
+			startTimer(a, sessions)
+		case a.state == gRPC.AuctionState_CLOSED:
+			settlement.schedule(a)
+		}
+	}
+	banned = map[string]bool{}
+	for _, name := range state.Banned {
+		banned[name] = true
+	}
+	updateActiveAuctions()
+}
+
+// replica serves the calls the replicas make to each other
+type replica struct {
+	gRPC.UnimplementedReplicaServer
+}
+
+func (r *replica) Identify(ctx context.Context, request *gRPC.IdentifyRequest) (*gRPC.IdentifyResponse, error) {
+	if err := checkPeerCertificate(ctx); err != nil {
+		return nil, err
+	}
+	if int(request.Replica) == *replicaFlag {
+		return nil, status.Errorf(codes.FailedPrecondition, "replica %d is already in the cluster, at %s", *replicaFlag, *listenAddr)
+	}
+	return &gRPC.IdentifyResponse{Replica: int32(*replicaFlag), Updates: updateCount()}, nil
+}
+
+func (r *replica) GetState(ctx context.Context, request *gRPC.StateRequest) (*gRPC.Snapshot, error) {
+	if err := checkPeerCertificate(ctx); err != nil {
+		return nil, err
+	}
+	healthMu.Lock()
+	caughtUp := !recovering && !draining
+	healthMu.Unlock()
+	if !caughtUp {
+		return nil, status.Error(codes.Unavailable, "this replica is recovering itself or shutting down")
+	}
+
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	state := &gRPC.Snapshot{ReplicaId: replicaID}
+	for _, a := range sortedAuctions() {
+		state.Auctions = append(state.Auctions, a.snapshot())
+	}
+	for name := range banned {
+		state.Banned = append(state.Banned, name)
+	}
+	sort.Strings(state.Banned)
+	return state, nil
+}
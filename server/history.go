@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultPageSize = 50
+const maxPageSize = 500
+
+// GetBidHistory pages through the accepted bids of an auction. The page token is the auction and the
+// sequence number to go on from, which is the same on every replica, so a client can switch replica between pages.
+func (s *Server) GetBidHistory(ctx context.Context, request *gRPC.BidHistoryRequest) (*gRPC.BidHistoryResponse, error) {
+	if request.AuctionId == "" {
+		request.AuctionId = defaultAuction
+	}
+	size := int(request.PageSize)
+	if size < 0 {
+		return nil, status.Error(codes.InvalidArgument, "the page size must not be negative")
+	}
+	if size == 0 {
+		size = defaultPageSize
+	}
+	size = min(size, maxPageSize)
+	from := uint64(1)
+	if request.PageToken != "" {
+		var err error
+		if from, err = parsePageToken(request.PageToken, request.AuctionId); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	// a replica that is still catching up could leave bids out
+	if !serving() {
+		return nil, notServingError()
+	}
+	a, ok := auctions[request.AuctionId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "there is no auction %q", request.AuctionId)
+	}
+
+	response := &gRPC.BidHistoryResponse{}
+	names := map[string]string{}
+	for _, bid := range a.bids {
+		if request.Anonymize || *anonymizeBids {
+			// numbered over every bid, not just this page, so the names stay the same between pages
+			if _, ok := names[bid.Bidder]; !ok {
+				names[bid.Bidder] = "bidder " + strconv.Itoa(len(names)+1)
+			}
+		}
+		if bid.Sequence < from {
+			continue
+		}
+		if len(response.Bids) == size {
+			response.NextPageToken = pageToken(a.id, bid.Sequence)
+			break
+		}
+		page := &gRPC.Bid{Sequence: bid.Sequence, Bidder: bid.Bidder, Amount: bid.Amount, At: bid.At, Retracted: bid.Retracted}
+		if name, ok := names[bid.Bidder]; ok {
+			page.Bidder = name
+		}
+		response.Bids = append(response.Bids, page)
+	}
+	return response, nil
+}
+
+func pageToken(auction string, from uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(auction + ":" + strconv.FormatUint(from, 10)))
+}
+
+// the sequence number a page token goes on from, as long as it is for the auction
+func parsePageToken(token string, auction string) (uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	i := strings.LastIndex(string(data), ":")
+	if i < 0 || string(data[:i]) != auction {
+		return 0, fmt.Errorf("the page token is not for auction %q", auction)
+	}
+	from, err := strconv.ParseUint(string(data[i+1:]), 10, 64)
+	if err != nil || from == 0 {
+		return 0, fmt.Errorf("invalid page token")
+	}
+	return from, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestPageToken(t *testing.T) {
+	for _, test := range []struct {
+		auction string
+		from    uint64
+	}{
+		{"default", 1},
+		{"car", 51},
+		{"a:b", 7}, // the sequence is after the last colon
+	} {
+		from, err := parsePageToken(pageToken(test.auction, test.from), test.auction)
+		if err != nil || from != test.from {
+			t.Errorf("round trip of %s from %d = %d, %v", test.auction, test.from, from, err)
+		}
+	}
+}
+
+func TestParsePageTokenErrors(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name    string
+		token   string
+		auction string
+	}{
+		{"other auction", pageToken("car", 5), "bike"},
+		{"not base64", "!!!", "car"},
+		{"no sequence", encode("car"), "car"},
+		{"sequence zero", encode("car:0"), "car"},
+		{"sequence not a number", encode("car:x"), "car"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if from, err := parsePageToken(test.token, test.auction); err == nil {
+				t.Errorf("parsePageToken() = %d, want an error", from)
+			}
+		})
+	}
+}
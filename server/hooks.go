@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// a settlementHook is run once for every order, by the replica that settles the auction.
+// To add one, implement it here and add it in loadHooks.
+type settlementHook interface {
+	name() string
+	run(ctx context.Context, order *gRPC.Order) error
+}
+
+// the hooks given with -settle-webhook and -settle-export
+func loadHooks() []settlementHook {
+	var hooks []settlementHook
+	if *settleWebhook != "" {
+		hooks = append(hooks, &webhookHook{url: *settleWebhook})
+	}
+	if *settleExport != "" {
+		hooks = append(hooks, &fileHook{path: *settleExport})
+	}
+	return hooks
+}
+
+var orderJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// webhookHook posts the order as json to a url, ex. a local service that sends the invoice
+type webhookHook struct {
+	url string
+}
+
+func (h *webhookHook) name() string { return "webhook" }
+
+func (h *webhookHook) run(ctx context.Context, order *gRPC.Order) error {
+	data, err := orderJSON.Marshal(order)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", h.url, response.Status)
+	}
+	return nil
+}
+
+// fileHook appends the order as a line of json to a file
+type fileHook struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (h *fileHook) name() string { return "export" }
+
+func (h *fileHook) run(ctx context.Context, order *gRPC.Order) error {
+	data, err := orderJSON.Marshal(order)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// gives every call a request id, taken from the callers metadata if it sent one,
+// and logs the call when it is done
+func loggingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = withLogIDs(ctx)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	slog.DebugContext(ctx, "call finished", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withLogIDs(stream.Context())
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	slog.DebugContext(ctx, "stream finished", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return err
+}
+
+// the request id, and the trace id if the call is traced, for everything logged about the call
+func withLogIDs(ctx context.Context) context.Context {
+	ctx = logging.WithRequestID(ctx, logging.IncomingRequestID(ctx))
+	if span := tracing.FromContext(ctx); span != nil {
+		ctx = logging.With(ctx, "trace_id", span.TraceID())
+	}
+	return ctx
+}
+
+// wraps a server stream so the handler sees a context made by an interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
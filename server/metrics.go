@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/mbjnitu/AuctionSystem-replication/metrics"
+)
+
+// everything the server exports on /metrics
+var registry = metrics.NewRegistry()
+
+var bidsTotal = registry.Counter("auction_bids_total", "Bids received, by outcome.", "outcome")
+var retractionsTotal = registry.Counter("auction_retractions_total", "Bid retractions asked for, by outcome.", "outcome")
+var hooksTotal = registry.Counter("auction_settlement_hooks_total", "Settlement hooks run by this replica, by hook and outcome.", "hook", "outcome")
+var webhooksTotal = registry.Counter("auction_webhooks_total", "Webhook deliveries, by outcome: delivered, retried or dead.", "outcome")
+var activeAuctions = registry.Gauge("auction_active_auctions", "Auctions that are open for bids.")
+var subscribers = registry.Gauge("auction_join_subscribers", "Open Join streams.")
+var watchers = registry.Gauge("auction_watchers", "Open Watch streams.")
+var broadcastSeconds = registry.Histogram("auction_broadcast_seconds", "Time taken to send a message to every Join stream.", metrics.DefaultBuckets)
+var rateLimitedTotal = registry.Counter("auction_rate_limited_total", "Calls turned down by the rate limits.")
+var peerUp = registry.Gauge("auction_peer_up", "1 if the connection to the peer replica is ready.", "peer")
+var replicationLag = registry.Gauge("auction_replication_lag", "Auction updates this replica has that the peer does not have yet.", "peer")
+var leaderChanges = registry.Counter("auction_leader_changes_total", "Times the replica that sends the webhooks and settles auctions first changed.")
+
+// the outcomes bids are counted by
+const (
+	outcomeAccepted     = "accepted"
+	outcomeTooLow       = "too_low"
+	outcomeBelowReserve = "below_reserve"
+	outcomeNoCredit     = "no_credit"
+	outcomeUnknown      = "unknown_bidder"
+	outcomeAuctionOver  = "auction_over"
+	outcomePaused       = "auction_paused"
+	outcomeNotOpen      = "auction_not_open"
+)
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// tokenBucket allows burst calls at once, refilled at rate calls per second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take uses a token if there is one, otherwise it returns how long until there is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter keeps a bucket per bidder and one shared by everybody.
+// A zero rate turns that limit off.
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      int
+	bidders    map[string]*tokenBucket
+	global     *tokenBucket
+	lastSweep  time.Time
+	sweepEvery time.Duration
+}
+
+func newRateLimiter(rate float64, burst int, globalRate float64, globalBurst int) *rateLimiter {
+	now := time.Now()
+	l := &rateLimiter{
+		rate:       rate,
+		burst:      burst,
+		bidders:    make(map[string]*tokenBucket),
+		lastSweep:  now,
+		sweepEvery: time.Minute,
+	}
+	if globalRate > 0 {
+		l.global = newTokenBucket(globalRate, globalBurst, now)
+	}
+	return l
+}
+
+// allow reports if the bidder may make a call now, and if not, when they can try again.
+// A call that is turned down does not use up any tokens.
+func (l *rateLimiter) allow(bidder string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	var bucket *tokenBucket
+	if l.rate > 0 {
+		bucket = l.bidders[bidder]
+		if bucket == nil {
+			bucket = newTokenBucket(l.rate, l.burst, now)
+			l.bidders[bidder] = bucket
+		}
+		bucket.refill(now)
+		if bucket.tokens < 1 {
+			return bucket.take(now)
+		}
+	}
+	if l.global != nil {
+		if ok, wait := l.global.take(now); !ok {
+			return false, wait
+		}
+	}
+	if bucket != nil {
+		bucket.take(now)
+	}
+	return true, 0
+}
+
+// forgets the buckets that have filled up again, so bidders that left don't take up memory
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.sweepEvery {
+		return
+	}
+	l.lastSweep = now
+	for bidder, bucket := range l.bidders {
+		bucket.refill(now)
+		if bucket.tokens >= bucket.burst {
+			delete(l.bidders, bidder)
+		}
+	}
+}
+
+// the name the call is counted against: the bidder its token was issued to, or else the host the call came from.
+// The sender of a message is not used, a caller could pick a new one for every call.
+func callerOf(ctx context.Context) string {
+	if name, ok := ctx.Value(bidderKey{}).(string); ok {
+		return name
+	}
+	return hostOf(ctx)
+}
+
+// hostOf gives the host a call came from, without the port, so a caller does not get a new bucket by
+// reconnecting. The gateway passes on the host of its own caller as "x-forwarded-for", which is only trusted
+// from the -trusted-gateway addresses, so other callers can not pick their bucket.
+func hostOf(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	addr, ok := p.Addr.(*net.TCPAddr)
+	if !ok {
+		return p.Addr.String()
+	}
+	if isTrustedGateway(addr.IP) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("x-forwarded-for"); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return addr.IP.String()
+}
+
+func isTrustedGateway(ip net.IP) bool {
+	if *trustedGateway == "" {
+		return false
+	}
+	for _, gateway := range strings.Split(*trustedGateway, ",") {
+		if ip.Equal(net.ParseIP(gateway)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unaryInterceptor limits the calls of bidders. Calls between replicas, admin calls and health checks are not
+// limited, so state recovery, settlement and probes keep working when bidders are turned down.
+func (l *rateLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, bidderPrefix) {
+		return handler(ctx, req)
+	}
+	caller := callerOf(ctx)
+	if ok, wait := l.allow(caller); !ok {
+		slog.WarnContext(ctx, "rate limited", "caller", caller, "method", info.FullMethod, "retry_in", wait)
+		rateLimitedTotal.Inc()
+		return nil, rateLimitedError(ctx, wait)
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor counts opening a Join or Watch stream as one call, so a caller can not get around the limits
+// by opening streams over and over. What is sent on a stream after that is not limited.
+func (l *rateLimiter) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !strings.HasPrefix(info.FullMethod, bidderPrefix) {
+		return handler(srv, stream)
+	}
+	ctx := stream.Context()
+	caller := callerOf(ctx)
+	if ok, wait := l.allow(caller); !ok {
+		slog.WarnContext(ctx, "rate limited", "caller", caller, "method", info.FullMethod, "retry_in", wait)
+		rateLimitedTotal.Inc()
+		return rateLimitedError(ctx, wait)
+	}
+	return handler(srv, stream)
+}
+
+// a RESOURCE_EXHAUSTED status telling the caller when to retry, both as a RetryInfo
+// detail and as a "retry-after" trailer in whole seconds
+func rateLimitedError(ctx context.Context, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("too many requests, retry in %v", wait.Round(time.Millisecond)))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
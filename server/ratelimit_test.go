@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		takes    int           // taken at start
+		after    time.Duration // then one more is tried this much later
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{"within the burst", 5, 10, 9, 0, true, 0},
+		{"burst used up", 5, 10, 10, 0, false, 200 * time.Millisecond},
+		{"refilled a token", 5, 10, 10, 200 * time.Millisecond, true, 0},
+		{"half a token back", 5, 10, 10, 100 * time.Millisecond, false, 100 * time.Millisecond},
+		{"refill stops at the burst", 1, 2, 2, time.Hour, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTokenBucket(test.rate, test.burst, start)
+			for i := 0; i < test.takes; i++ {
+				if ok, _ := b.take(start); !ok {
+					t.Fatalf("take %d turned down", i+1)
+				}
+			}
+			ok, wait := b.take(start.Add(test.after))
+			if ok != test.wantOK || (wait-test.wantWait).Abs() > time.Millisecond {
+				t.Errorf("take() = %v, %v, want %v, %v", ok, wait, test.wantOK, test.wantWait)
+			}
+			if b.tokens > float64(test.burst) {
+				t.Errorf("the bucket holds %v tokens, more than the burst of %d", b.tokens, test.burst)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *rateLimiter
+		calls   []string // the callers, in order
+		want    []bool
+	}{
+		{"per bidder", newRateLimiter(1, 2, 0, 0), []string{"alice", "alice", "alice", "bob"}, []bool{true, true, false, true}},
+		{"global", newRateLimiter(0, 0, 1, 2), []string{"alice", "bob", "carol"}, []bool{true, true, false}},
+		// a call the global limit turns down does not use up the bidder's tokens
+		{"global first", newRateLimiter(1, 1, 1, 1), []string{"alice", "bob", "bob"}, []bool{true, false, false}},
+		{"off", newRateLimiter(0, 0, 0, 0), []string{"alice", "alice", "alice"}, []bool{true, true, true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, caller := range test.calls {
+				if ok, _ := test.limiter.allow(caller); ok != test.want[i] {
+					t.Errorf("call %d by %s allowed = %v, want %v", i+1, caller, ok, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterOnlyLimitsBidders(t *testing.T) {
+	l := newRateLimiter(1, 1, 0, 0)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	tests := []struct {
+		method string
+		want   codes.Code
+	}{
+		{"/proto.AuctionSystem/Publish", codes.OK},
+		{"/proto.AuctionSystem/Publish", codes.ResourceExhausted},
+		{"/proto.AuctionSystem/GetBidHistory", codes.ResourceExhausted},
+		{"/proto.Replica/GetState", codes.OK},
+		{"/proto.AuctionAdmin/ListAuctions", codes.OK},
+		{"/grpc.health.v1.Health/Check", codes.OK},
+	}
+	for _, test := range tests {
+		_, err := l.unaryInterceptor(context.Background(), &gRPC.Message{Sender: "alice"}, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+		if got := status.Code(err); got != test.want {
+			t.Errorf("%s = %v, want %v", test.method, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiterLimitsStreams(t *testing.T) {
+	l := newRateLimiter(1, 1, 0, 0)
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+	stream := &contextStream{ctx: context.Background()}
+	tests := []struct {
+		method string
+		want   codes.Code
+	}{
+		{"/proto.AuctionSystem/Join", codes.OK},
+		{"/proto.AuctionSystem/Join", codes.ResourceExhausted},
+		{"/proto.AuctionSystem/Watch", codes.ResourceExhausted},
+		{"/grpc.health.v1.Health/Watch", codes.OK},
+	}
+	for _, test := range tests {
+		err := l.streamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: test.method, IsServerStream: true}, handler)
+		if got := status.Code(err); got != test.want {
+			t.Errorf("%s = %v, want %v", test.method, got, test.want)
+		}
+	}
+}
+
+func TestCallerOf(t *testing.T) {
+	old := *trustedGateway
+	defer func() { *trustedGateway = old }()
+	*trustedGateway = "10.0.0.9"
+
+	from := func(ip string, port int, forwarded string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: port}})
+		if forwarded != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwarded))
+		}
+		return ctx
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"logged in bidder", context.WithValue(from("10.0.0.1", 4000, ""), bidderKey{}, "alice"), "alice"},
+		{"not logged in", from("10.0.0.1", 4000, ""), "10.0.0.1"},
+		{"reconnected", from("10.0.0.1", 4001, ""), "10.0.0.1"},
+		{"through the gateway", from("10.0.0.9", 4000, "10.0.0.2"), "10.0.0.2"},
+		{"forwarded by someone else", from("10.0.0.1", 4000, "10.0.0.2"), "10.0.0.1"},
+		{"forwarded from localhost", from("127.0.0.1", 4000, "10.0.0.2"), "127.0.0.1"},
+		{"no peer", context.Background(), ""},
+	}
+	for _, test := range tests {
+		if got := callerOf(test.ctx); got != test.want {
+			t.Errorf("%s: callerOf = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+)
+
+// the outcomes retractions are counted by
+const (
+	retractOK      = "retracted"
+	retractNotTop  = "not_highest"
+	retractTooLate = "too_late"
+	retractEnding  = "auction_ending"
+	retractNotOpen = "auction_not_open"
+)
+
+// retractBid takes back the highest bid if it is the bidder's, it was made within -retract-window and the
+// auction is not in its cutoff. The bid before it becomes the highest bid again.
+// Every replica gets the retraction like it gets bids. Returns what the bidder was told and the outcome.
+// Must be called holding auctionMu.
+func retractBid(ctx context.Context, a *auction, bidder string, sessions *sessionHub) (*gRPC.Message, string) {
+	top := a.topBid()
+	refuse := func(outcome string, text string) (*gRPC.Message, string) {
+		retractionsTotal.Inc(outcome)
+		slog.InfoContext(ctx, "retraction refused", "reason", outcome)
+		reply := &gRPC.Message{Sender: "Server", Message: text, Auction: a.id}
+		sessions.sendTo(bidder, reply)
+		return reply, outcome
+	}
+	switch {
+	case a.state != gRPC.AuctionState_OPEN:
+		return refuse(retractNotOpen, "Bids can only be retracted while the auction is open")
+	case top == nil || top.Bidder != bidder:
+		return refuse(retractNotTop, "You can only retract your own bid while it is the highest bid")
+	case time.Since(time.UnixMilli(top.At)) > *retractWindow:
+		return refuse(retractTooLate, "Bids can only be retracted within "+retractWindow.String()+" of being made")
+	case !a.ends.IsZero() && time.Until(a.ends) < a.retractCutoff():
+		return refuse(retractEnding, "Bids can not be retracted in the final "+a.retractCutoff().String()+" of the auction")
+	}
+
+	top.Retracted = true
+	bidders.release(bidder, a.id)
+	a.amount, a.bidder = 0, ""
+	// the previous bid may no longer stand, ex. its bidder was banned or has used the credit elsewhere since
+	for i := len(a.bids) - 1; i >= 0; i-- {
+		bid := a.bids[i]
+		if bid.Retracted || banned[bid.Bidder] {
+			continue
+		}
+		if _, err := bidders.reserve(bid.Bidder, a.id, bid.Amount); err != nil {
+			slog.InfoContext(ctx, "previous bid can not be held again, skipping it", "bidder", bid.Bidder, "amount", bid.Amount, "err", err)
+			continue
+		}
+		a.amount, a.bidder = bid.Amount, bid.Bidder
+		break
+	}
+
+	retractionsTotal.Inc(retractOK)
+	slog.InfoContext(ctx, "bid retracted", "amount", top.Amount, "highest", a.amount, "highest_bidder", a.bidder)
+	record(ctx, audit.Entry{Event: audit.Retracted, Auction: a.id, Bidder: bidder, Amount: top.Amount})
+	webhooks.emit(WebhookEvent{
+		ID:      a.id + "/retract/" + strconv.FormatUint(top.Sequence, 10),
+		Type:    "bid.retracted",
+		Auction: a.id,
+		Bidder:  bidder,
+		Amount:  top.Amount,
+	})
+	a.addUpdate(&gRPC.AuctionUpdate{Type: "bid.retracted", Bidder: bidder, Amount: top.Amount})
+	text := bidder + " retracted their bid, the highest bid is now " + orNobody(a.bidder) + " with a value of: "
+	reply := &gRPC.Message{Sender: "Server", Message: text, Bid: a.amount, Auction: a.id}
+	sessions.sendToAll(ctx, reply)
+	return reply, retractOK
+}
+
+// retractCutoff is how long before the end of the auction bids can no longer be retracted: -retract-cutoff, but
+// at most half of the auction, so bids in auctions shorter than the cutoff can still be retracted in their first half
+func (a *auction) retractCutoff() time.Duration {
+	return min(*retractCutoff, a.duration/2)
+}
+
+// the bid that is the highest bid now, nil if there is none
+func (a *auction) topBid() *gRPC.Bid {
+	for i := len(a.bids) - 1; i >= 0; i-- {
+		bid := a.bids[i]
+		if !bid.Retracted && bid.Bidder == a.bidder && bid.Amount == a.amount {
+			return bid
+		}
+	}
+	return nil
+}
+
+func orNobody(name string) string {
+	if name == "" {
+		return "nobody"
+	}
+	return name
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetractCutoff(t *testing.T) {
+	old := *retractCutoff
+	defer func() { *retractCutoff = old }()
+	*retractCutoff = 2 * time.Minute
+
+	tests := []struct {
+		duration time.Duration
+		want     time.Duration
+	}{
+		{time.Hour, 2 * time.Minute},
+		{4 * time.Minute, 2 * time.Minute},
+		{3 * time.Minute, 90 * time.Second},
+		{10 * time.Second, 5 * time.Second},
+	}
+	for _, test := range tests {
+		a := &auction{duration: test.duration}
+		if got := a.retractCutoff(); got != test.want {
+			t.Errorf("cutoff of a %v auction = %v, want %v", test.duration, got, test.want)
+		}
+	}
+}
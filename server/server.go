@@ -4,108 +4,305 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	// this has to be the same as the go.mod module,
 	// followed by the path to the folder the proto file is in.
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
 	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type Server struct {
 	gRPC.UnimplementedAuctionSystemServer        // You need this line if you have a server struct
-	port                                  string // Not required but useful if your server needs to know what port it's listening to
+	addr                                  string // the address the server listens on
 
-	streams map[string]*gRPC.AuctionSystem_JoinServer // map of streams
+	sessions *sessionHub                 // every open Join stream
+	peers    map[string]*grpc.ClientConn // connections to the other replicas
 }
 
 // flags are used to get arguments from the terminal. Flags take a value, a default value and a description of the flag.
 // to use a flag then just add it as an argument when running the program.
-var port *string        // set with "-port <port>" in terminal
-var serverName = "port" // name of the server
-var serverPort string   // port of the server port
-var serverSomething = "server port"
-
-// Vars related to bidding:
-var currentAmount int64 = 0
-var currentHighestBidder string
-var auctionOver bool = false
+// Every flag can also be set in the environment or a config file, see config.go.
+var replicaFlag = flag.Int("replica", -1, "number of this replica, can also be given after the flags")
+var listenAddr = flag.String("listen", "", "address to listen on, defaults to localhost:[5000 + replica]")
+var dataDir = flag.String("data-dir", ".", "directory for the audit and log files, unless they are given with a path of their own")
+var auctionDuration = flag.Duration("auction-duration", 10*time.Second, "how long an auction is open")
+var retractWindow = flag.Duration("retract-window", time.Minute, "how long after making a bid the bidder may retract it, 0 to not allow retracting")
+var retractCutoff = flag.Duration("retract-cutoff", 2*time.Minute, "bids can not be retracted when the auction has less than this left, or less than half of it for shorter auctions")
+var anonymizeBids = flag.Bool("anonymize-bids", false, "always hide the names of the bidders in the bid history")
+var biddersFile = flag.String("bidders", "", "json file with registered bidders and their credit limits")
+var authKeyFile = flag.String("auth-key", "", "file with the key used to sign login tokens, enables authentication")
+var tokenTTL = flag.Duration("token-ttl", time.Hour, "how long a login token is valid")
+var adminTokenFile = flag.String("admin-token", "", "file with the token admin calls have to send, without it admin calls are only accepted from localhost")
+var hashPasswordFlag = flag.String("hash-password", "", "print the bcrypt hash of a password for the password_hash field of the bidders file and exit")
+var tlsCertFile = flag.String("tls-cert", "", "certificate of this replica, enables TLS")
+var tlsKeyFile = flag.String("tls-key", "", "private key for -tls-cert")
+var tlsCAFile = flag.String("tls-ca", "", "CA certificate used to verify the other replicas (mTLS)")
+var bidRate = flag.Float64("rate", 5, "calls per second each bidder may make, 0 for no limit")
+var bidBurst = flag.Int("burst", 10, "calls a bidder may make at once before -rate applies")
+var globalRate = flag.Float64("global-rate", 200, "calls per second for all bidders together, 0 for no limit")
+var trustedGateway = flag.String("trusted-gateway", "", "comma separated IPs of the gateways whose x-forwarded-for metadata is trusted to tell who is calling, ex. 127.0.0.1")
+var globalBurst = flag.Int("global-burst", 400, "calls all bidders may make at once before -global-rate applies")
+var auditLogFile = flag.String("audit-log", "", "file to keep the audit log of all bids in, defaults to [data-dir]/audit-[replica].log")
+var metricsAddr = flag.String("metrics", "", "address to serve /metrics on, defaults to localhost:[9000 + replica]")
+var logOutput = flag.String("log-output", "", "where to write logs: stdout, stderr or a file, defaults to [data-dir]/log.txt")
+var logFormat = flag.String("log-format", "json", "log format: json or text")
+var logLevel = flag.String("log-level", "info", "lowest level to log: debug, info, warn or error")
+var traceExport = flag.String("trace-export", "", "file or OTLP/HTTP url, ex. http://localhost:4318/v1/traces, to export traces to")
+var peerAddrs = flag.String("peers", "", "comma separated addresses of the other replicas, ex. localhost:5001,localhost:5002")
+var settleWebhook = flag.String("settle-webhook", "", "url to post the order of every closed auction to, ex. http://localhost:8080/orders")
+var settleExport = flag.String("settle-export", "", "file to append the order of every closed auction to, as a line of json")
+var settleLease = flag.Duration("settle-lease", 10*time.Second, "how long a replica has to settle an auction before another one may")
+var settleAttempts = flag.Int("settle-attempts", 6, "how many times to try a settlement hook that fails")
+var settleDeadLetter = flag.String("settle-dead-letter", "", "file to keep the orders whose hooks failed in, defaults to [data-dir]/settle-dead-[replica].jsonl")
+var webhooksFile = flag.String("webhooks", "", "json file with the urls to post auction events to")
+var webhookAttempts = flag.Int("webhook-attempts", 6, "how many times to try to deliver a webhook event")
+var webhookDeadLetter = flag.String("webhook-dead-letter", "", "file to keep webhook events that could not be delivered in, defaults to [data-dir]/webhooks-dead-[replica].jsonl")
+var webhookHandover = flag.Duration("webhook-handover", 5*time.Second, "how far back a replica sends webhook events again when it takes over sending them")
+var shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to let calls finish when shutting down")
+var recoveryTimeout = flag.Duration("recovery-timeout", 3*time.Second, "how long to wait for a peer to copy the auction from before starting a new one")
+
+// Vars related to bidding, the auctions themselves are in auction.go:
+var bidders *bidderRegistry
+var auth *authenticator
+var auditLog *audit.Log
+var replicaID string
+var auctionMu sync.Mutex // held while a message changes or reads the auctions
 
 func main() {
-	arg1, _ := strconv.ParseInt(os.Args[1], 10, 64)
-	serverPort32 := int64(arg1) + 5000
-	serverPort = strconv.FormatInt(serverPort32, 10)
-	fmt.Println(serverPort)
-	port = flag.String(serverName, serverPort, serverSomething)
-	f := setLog() //uncomment this line to log to a log.txt file instead of the console
-	defer f.Close()
-
 	// This parses the flags and sets the correct/given corresponding values.
+	// The replica number can be given after the flags, ex. "-bidders bidders.json 0"
 	flag.Parse()
+	if *hashPasswordFlag != "" {
+		hash, err := hashPassword(*hashPasswordFlag)
+		if err != nil {
+			logging.Fatal("failed to hash password", "err", err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
+	err := loadConfig(flag.CommandLine)
+	if err == nil {
+		applyDefaults()
+		err = validateConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	_, f, err := logging.New(logging.Config{Output: *logOutput, Format: *logFormat, Level: *logLevel}, "replica", replicaID)
+	if err != nil {
+		fmt.Printf("Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	fmt.Println(*listenAddr)
 	fmt.Println(".:server is starting:.")
 
-	// starts a goroutine executing the launchServer method.
+	if *biddersFile != "" {
+		registry, err := loadBidders(*biddersFile)
+		if err != nil {
+			logging.Fatal("failed to load bidders", "file", *biddersFile, "err", err)
+		}
+		bidders = registry
+		slog.Info("loaded bidders", "file", *biddersFile, "count", len(registry.bidders))
+	}
+
+	if *webhooksFile != "" {
+		sender, err := loadWebhooks(*webhooksFile)
+		if err != nil {
+			logging.Fatal("failed to load webhooks", "file", *webhooksFile, "err", err)
+		}
+		webhooks = sender
+		slog.Info("loaded webhooks", "file", *webhooksFile, "count", len(sender.subscriptions))
+	}
+
+	opened, err := audit.Open(*auditLogFile, replicaID)
+	if err != nil {
+		logging.Fatal("failed to open audit log", "err", err)
+	}
+	auditLog = opened // closed when the server shuts down
+
+	if *authKeyFile != "" {
+		authenticator, err := loadAuthenticator(*authKeyFile, *tokenTTL)
+		if err != nil {
+			logging.Fatal("failed to load auth key", "file", *authKeyFile, "err", err)
+		}
+		auth = authenticator
+		slog.Info("authentication enabled", "token_ttl", *tokenTTL)
+	}
+
+	if *adminTokenFile != "" {
+		token, err := loadAdminToken(*adminTokenFile)
+		if err != nil {
+			logging.Fatal("failed to load admin token", "file", *adminTokenFile, "err", err)
+		}
+		adminToken = token
+	}
+
+	if *traceExport != "" {
+		shutdown, err := tracing.Setup("auction-server", replicaID, *traceExport)
+		if err != nil {
+			logging.Fatal("failed to set up tracing", "dest", *traceExport, "err", err)
+		}
+		defer shutdown()
+		slog.Info("exporting traces", "dest", *traceExport)
+	}
+
+	if err := registry.Serve(*metricsAddr); err != nil {
+		logging.Fatal("failed to serve metrics", "addr", *metricsAddr, "err", err)
+	}
+	slog.Info("serving metrics", "url", "http://"+*metricsAddr+"/metrics")
+
+	// launchServer returns once the server has shut down, after which the logs and traces are flushed
 	launchServer()
-	// code here is unreachable because launchServer occupies the current thread.
 }
 
 func launchServer() {
-	fmt.Printf("Attempts to create listener on port %s\n", *port)
+	fmt.Printf("Attempts to create listener on %s\n", *listenAddr)
 
-	// Create listener tcp on given port or default port 5400
-	list, err := net.Listen("tcp", fmt.Sprintf("localhost:%s", *port))
+	// Create listener tcp on the given address
+	list, err := net.Listen("tcp", *listenAddr)
 	if err != nil {
-		fmt.Printf("Failed to listen on port %s: %v", *port, err) //If it fails to listen on the port, run launchServer method again with the next value/port in ports array
-		return
+		fmt.Printf("Failed to listen on %s: %v\n", *listenAddr, err)
+		logging.Fatal("failed to listen", "addr", *listenAddr, "err", err)
 	}
 
 	// makes gRPC server using the options
 	// you can add options here if you want or remove the options part entirely
 	var opts []grpc.ServerOption
+	if tlsEnabled() {
+		creds, err := serverCredentials()
+		if err != nil {
+			logging.Fatal("failed to load TLS credentials", "err", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	// traces and request ids are set up first so everything after records them, then authentication,
+	// so the rate limits count calls against the logged in bidder. Admin calls are checked apart from bidders.
+	unary := []grpc.UnaryServerInterceptor{tracing.UnaryServerInterceptor, loggingUnaryInterceptor, adminInterceptor}
+	stream := []grpc.StreamServerInterceptor{tracing.StreamServerInterceptor, loggingStreamInterceptor}
+	if auth != nil {
+		unary = append(unary, auth.unaryInterceptor)
+		stream = append(stream, auth.streamInterceptor)
+	}
+	limiter := newRateLimiter(*bidRate, *bidBurst, *globalRate, *globalBurst)
+	unary = append(unary, limiter.unaryInterceptor)
+	stream = append(stream, limiter.streamInterceptor)
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
 	grpcServer := grpc.NewServer(opts...)
 
-	// makes a new server instance using the name and port from the flags.
+	peers, err := connectToPeers()
+	if err != nil {
+		logging.Fatal("failed to connect to peers", "err", err)
+	}
+
+	// makes a new server instance using the address from the flags.
 	server := &Server{
-		port:    *port,
-		streams: make(map[string]*gRPC.AuctionSystem_JoinServer),
+		addr:     *listenAddr,
+		sessions: newSessionHub(),
+		peers:    peers,
+	}
+	settlement = newSettler("replica "+replicaID, peers, server.sessions)
+	if webhooks != nil {
+		webhooks.start()
 	}
+	// opened before anyone can join, so it is not announced and not in the audit log
+	a := newAuction(defaultAuction, 0, *auctionDuration)
+	a.state = gRPC.AuctionState_OPEN
+	a.history = []*gRPC.AuctionEvent{{Auction: a.id, From: gRPC.AuctionState_DRAFT, To: gRPC.AuctionState_OPEN, At: a.created.UnixMilli()}}
+	a.ends = a.created.Add(a.duration)
+	startTimer(a, server.sessions)
+	auctions[a.id] = a
+	updateActiveAuctions()
 
 	gRPC.RegisterAuctionSystemServer(grpcServer, server) //Registers the server to the gRPC server.
+	gRPC.RegisterReplicaServer(grpcServer, &replica{})
+	gRPC.RegisterAuctionAdminServer(grpcServer, &admin{sessions: server.sessions})
+	healthpb.RegisterHealthServer(grpcServer, healthService{healthServer})
+	reflection.Register(grpcServer)
+
+	// the replica is not serving until it has caught up with its peers
+	updateHealth()
+	go recoverState(peers, server.sessions)
+	go handleSignals(grpcServer, server.sessions)
 
 	fmt.Println("Clients should dial: ", GetOutboundIP())
 
 	if err := grpcServer.Serve(list); err != nil {
-		log.Fatalf("failed to serve %v", err)
+		logging.Fatal("failed to serve", "err", err)
 	}
-	// code here is unreachable because grpcServer.Serve occupies the current thread.
+	// Serve returns once the server has shut down
+	fmt.Println("Server stopped")
 }
 
 func (s *Server) Join(request *gRPC.JoinRequest, stream gRPC.AuctionSystem_JoinServer) error {
-	log.Printf("Server: Join request from %s\n", request.Name)
+	ctx := logging.With(stream.Context(), "bidder", request.Name)
+	slog.InfoContext(ctx, "join request", "mode", request.Mode.String())
+	if err := checkBidder(stream.Context(), request.Name); err != nil {
+		return err
+	}
+	if !serving() {
+		return notServingError()
+	}
+	if isBanned(request.Name) {
+		return bannedError()
+	}
 
-	// adds the stream to the streams map
-	s.streams[request.Name] = &stream
+	// adds the stream to the sessions of the bidder
+	session, first, err := s.sessions.join(request.Name, request.Mode, stream)
+	if err != nil {
+		slog.WarnContext(ctx, "rejected join", "err", err)
+		return status.Errorf(codes.AlreadyExists, "%s is already in the auction, join with attach or takeover mode to use it from here", request.Name)
+	}
+	stream.SendHeader(metadata.Pairs("session-id", session.id))
+	ctx = logging.With(ctx, "session", session.id)
+	slog.InfoContext(ctx, "joined")
 
-	// sends a message to the client
-	sendToAll(s.streams, &gRPC.Message{
+	// sends a message to the clients, the others only have to hear about the bidder the first time
+	welcome := &gRPC.Message{
 		Sender:  "Server",
 		Message: "Welcome " + request.Name + " to the auction!",
 		Bid:     0,
-	})
+	}
+	if first {
+		s.sessions.sendToAll(ctx, welcome)
+	} else {
+		session.send(welcome)
+	}
 
-	// waits for the stream to be closed -- happens when the client stops
-	// then removes the stream from the streams map
-	// and sends a message to the other clients
-	<-stream.Context().Done()
-	delete(s.streams, request.Name)
-	log.Println(request.Name, "disconnected")
+	// waits for the stream to be closed -- happens when the client stops or another session takes over
+	// then removes the session
+	// and sends a message to the other clients if it was the bidders last session
+	select {
+	case <-stream.Context().Done():
+	case <-session.closed:
+		return session.reason
+	}
+	if !s.sessions.leave(session) {
+		slog.InfoContext(ctx, "session disconnected")
+		return nil
+	}
+	slog.InfoContext(ctx, "bidder disconnected")
 
-	sendToAll(s.streams, &gRPC.Message{
+	s.sessions.sendToAll(ctx, &gRPC.Message{
 		Sender:  "Server",
 		Message: request.Name + " has left the auction",
 		Bid:     0,
@@ -114,64 +311,170 @@ func (s *Server) Join(request *gRPC.JoinRequest, stream gRPC.AuctionSystem_JoinS
 }
 
 func (s *Server) Publish(ctx context.Context, message *gRPC.Message) (*gRPC.PublishResponse, error) {
+	if err := checkBidder(ctx, message.Sender); err != nil {
+		return nil, err
+	}
+	if message.Auction == "" {
+		message.Auction = defaultAuction
+	}
 
-	processInput(message, s.streams)
+	ctx = logging.With(ctx, "auction", message.Auction, "bidder", message.Sender)
+	if span := tracing.FromContext(ctx); span != nil {
+		span.SetAttributes("auction", message.Auction, "bidder", message.Sender, "command", message.Message, "amount", message.Bid)
+	}
+	// checked while holding the lock, so no bid gets past a shutdown waiting for the lock
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	if !serving() {
+		return nil, notServingError()
+	}
+	if banned[message.Sender] {
+		return nil, bannedError()
+	}
+	a, ok := auctions[message.Auction]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "there is no auction %q", message.Auction)
+	}
+	reply, outcome := processInput(ctx, a, message, s.sessions)
 
-	return &gRPC.PublishResponse{}, nil
+	return &gRPC.PublishResponse{Reply: reply, Outcome: outcome}, nil
 }
 
-func processInput(message *gRPC.Message, streams map[string]*gRPC.AuctionSystem_JoinServer) {
+// processInput acts on a message of a bidder, and returns what the bidder was told and the outcome, ex.
+// outcomeAccepted. Must be called holding auctionMu.
+func processInput(ctx context.Context, a *auction, message *gRPC.Message, sessions *sessionHub) (reply *gRPC.Message, outcome string) {
 	if message.Message == "bid" {
-		if message.Bid > currentAmount && !auctionOver {
-			if currentAmount == 0 {
-				go endAuction(message, streams)
+		record(ctx, audit.Entry{Event: audit.Attempt, Auction: a.id, Bidder: message.Sender, Amount: message.Bid})
+		if a.state == gRPC.AuctionState_DRAFT || a.state == gRPC.AuctionState_SCHEDULED {
+			record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: "auction is not open yet"})
+			outcome = outcomeNotOpen
+			bidsTotal.Inc(outcome)
+			reply = &gRPC.Message{
+				Sender:  "Server",
+				Message: "The auction has not opened yet, the reserve price is: ",
+				Bid:     a.reserve,
+				Auction: a.id,
+			}
+			sessions.sendTo(message.Sender, reply)
+		} else if a.state == gRPC.AuctionState_PAUSED {
+			record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: "auction is paused"})
+			outcome = outcomePaused
+			bidsTotal.Inc(outcome)
+			reply = &gRPC.Message{
+				Sender:  "Server",
+				Message: "The auction is paused, bids are turned down until it resumes. The highest bid is: ",
+				Bid:     a.amount,
+				Auction: a.id,
+			}
+			sessions.sendTo(message.Sender, reply)
+		} else if a.over() {
+			reason := "auction is over"
+			if a.state == gRPC.AuctionState_CANCELLED {
+				reason = "auction was cancelled"
 			}
-			currentAmount = message.Bid
-			currentHighestBidder = message.Sender
-			sendToAll(streams, &gRPC.Message{
+			record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: reason})
+			outcome = outcomeAuctionOver
+			bidsTotal.Inc(outcome)
+			reply = overMessage(a)
+			sessions.sendToAll(ctx, reply)
+		} else if message.Bid < a.reserve {
+			record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: "below the reserve price"})
+			outcome = outcomeBelowReserve
+			bidsTotal.Inc(outcome)
+			reply = &gRPC.Message{
 				Sender:  "Server",
-				Message: "A new highest bet has been set by " + currentHighestBidder + " with a value of: ",
-				Bid:     currentAmount,
+				Message: "Your bid is below the reserve price of: ",
+				Bid:     a.reserve,
+				Auction: a.id,
+			}
+			sessions.sendTo(message.Sender, reply)
+		} else if message.Bid > a.amount {
+			if available, err := bidders.reserve(message.Sender, a.id, message.Bid); err != nil {
+				return rejectBid(ctx, a, sessions, message, available, err)
+			}
+			if a.bidder != message.Sender {
+				bidders.release(a.bidder, a.id)
+			}
+			outcome = outcomeAccepted
+			bidsTotal.Inc(outcome)
+			a.amount = message.Bid
+			a.bidder = message.Sender
+			a.bids = append(a.bids, &gRPC.Bid{
+				Sequence: uint64(len(a.bids) + 1),
+				Bidder:   message.Sender,
+				Amount:   message.Bid,
+				At:       time.Now().UnixMilli(),
 			})
-		} else if message.Bid <= currentAmount && !auctionOver {
-			sendToSpecific(streams, &gRPC.Message{
+			webhooks.emit(WebhookEvent{
+				ID:      a.id + "/bid/" + strconv.Itoa(len(a.bids)),
+				Type:    "bid.accepted",
+				Auction: a.id,
+				Bidder:  message.Sender,
+				Amount:  message.Bid,
+			})
+			a.addUpdate(&gRPC.AuctionUpdate{Type: "bid.accepted", Bidder: message.Sender, Amount: message.Bid})
+			record(ctx, audit.Entry{Event: audit.Accepted, Auction: a.id, Bidder: message.Sender, Amount: message.Bid})
+			reply = &gRPC.Message{
 				Sender:  "Server",
-				Message: "Your bid is not greater than the current highest bid of: ",
-				Bid:     currentAmount,
-			}, message.Sender)
-		} else if auctionOver {
-			sendToAll(streams, &gRPC.Message{
+				Message: "A new highest bet has been set by " + a.bidder + " with a value of: ",
+				Bid:     a.amount,
+				Auction: a.id,
+			}
+			sessions.sendToAll(ctx, reply)
+		} else {
+			record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: "not above the highest bid"})
+			outcome = outcomeTooLow
+			bidsTotal.Inc(outcome)
+			reply = &gRPC.Message{
 				Sender:  "Server",
-				Message: "The auction is over, and was won by " + currentHighestBidder + " at the price: ",
-				Bid:     currentAmount,
-			})
+				Message: "Your bid is not greater than the current highest bid of: ",
+				Bid:     a.amount,
+				Auction: a.id,
+			}
+			sessions.sendTo(message.Sender, reply)
 		}
-	} else if message.Message == "result" && !auctionOver {
-		sendToSpecific(streams, &gRPC.Message{
+	} else if message.Message == "retract" {
+		return retractBid(ctx, a, message.Sender, sessions)
+	} else if message.Message == "result" && !a.over() {
+		outcome = "result"
+		reply = &gRPC.Message{
 			Sender:  "Server",
 			Message: "The current result is: ",
-			Bid:     currentAmount,
-		}, message.Sender)
-	} else if auctionOver {
-		sendToAll(streams, &gRPC.Message{
-			Sender:  "Server",
-			Message: "The auction is over, and was won by " + currentHighestBidder + " at the price: ",
-			Bid:     currentAmount,
-		})
+			Bid:     a.amount,
+			Auction: a.id,
+		}
+		sessions.sendTo(message.Sender, reply)
+	} else if a.over() {
+		outcome = outcomeAuctionOver
+		reply = overMessage(a)
+		sessions.sendToAll(ctx, reply)
 	}
+	return reply, outcome
 }
 
-// sends a message to a specific stream in the streams map
-func sendToSpecific(streams map[string]*gRPC.AuctionSystem_JoinServer, message *gRPC.Message, sender string) {
-	stream := streams[sender]
-	(*stream).Send(message)
-}
-
-// sends a message to all streams in the streams map
-func sendToAll(streams map[string]*gRPC.AuctionSystem_JoinServer, message *gRPC.Message) {
-	for _, stream := range streams {
-		(*stream).Send(message)
+// tells the sender why the registry turned down their bid
+func rejectBid(ctx context.Context, a *auction, sessions *sessionHub, message *gRPC.Message, available int64, err error) (*gRPC.Message, string) {
+	record(ctx, audit.Entry{Event: audit.Rejected, Auction: a.id, Bidder: message.Sender, Amount: message.Bid, Reason: err.Error()})
+	if err == errUnknownBidder {
+		bidsTotal.Inc(outcomeUnknown)
+		reply := &gRPC.Message{
+			Sender:  "Server",
+			Message: "You are not a registered bidder",
+			Bid:     0,
+			Auction: a.id,
+		}
+		sessions.sendTo(message.Sender, reply)
+		return reply, outcomeUnknown
+	}
+	bidsTotal.Inc(outcomeNoCredit)
+	reply := &gRPC.Message{
+		Sender:  "Server",
+		Message: "Your bid exceeds your available credit of: ",
+		Bid:     available,
+		Auction: a.id,
 	}
+	sessions.sendTo(message.Sender, reply)
+	return reply, outcomeNoCredit
 }
 
 // Get preferred outbound ip of this machine
@@ -179,7 +482,7 @@ func sendToAll(streams map[string]*gRPC.AuctionSystem_JoinServer, message *gRPC.
 func GetOutboundIP() net.IP {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("failed to find outbound ip", "err", err)
 	}
 	defer conn.Close()
 
@@ -188,26 +491,14 @@ func GetOutboundIP() net.IP {
 	return localAddr.IP
 }
 
-// sets the logger to use a log.txt file instead of the console
-func setLog() *os.File {
-	// Clears the log.txt file when a new server is started
-	if err := os.Truncate("log.txt", 0); err != nil {
-		log.Printf("Failed to truncate: %v", err)
+// writes an entry about an auction or bidder to the audit log, and logs bids
+func record(ctx context.Context, entry audit.Entry) {
+	if entry.Event == audit.Rejected {
+		slog.InfoContext(ctx, "bid rejected", "amount", entry.Amount, "reason", entry.Reason)
+	} else if entry.Event == audit.Attempt || entry.Event == audit.Accepted {
+		slog.InfoContext(ctx, "bid "+entry.Event, "amount", entry.Amount)
 	}
-
-	// This connects to the log file/changes the output of the log informaiton to the log.txt file.
-	f, err := os.OpenFile("log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+	if err := auditLog.Append(entry); err != nil {
+		slog.ErrorContext(ctx, "failed to write to the audit log", "err", err)
 	}
-	log.SetOutput(f)
-	return f
-}
-
-func endAuction(message *gRPC.Message, streams map[string]*gRPC.AuctionSystem_JoinServer) {
-	time.Sleep(10 * time.Second)
-	auctionOver = true
-	fmt.Println("Auction has ended")
-	log.Printf("Auction has ended")
-	processInput(message, streams)
 }
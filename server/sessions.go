@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errNameTaken = errors.New("name already has a session")
+
+// a session is one Join stream. A bidder can have several sessions, ex. one per device.
+type session struct {
+	id     string
+	name   string
+	stream gRPC.AuctionSystem_JoinServer
+	sendMu sync.Mutex    // a stream must not be sent on from two goroutines at once
+	closed chan struct{} // closed when another session takes this one over, or the server shuts down
+	reason error         // what Join returns once closed is closed
+}
+
+func (s *session) send(message *gRPC.Message) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := s.stream.Send(message); err != nil {
+		slog.Warn("failed to send to session", "bidder", s.name, "session", s.id, "err", err)
+	}
+}
+
+// sessionHub keeps track of every open Join stream, grouped by bidder name
+type sessionHub struct {
+	mu     sync.Mutex
+	byName map[string]map[string]*session // name -> session id -> session
+}
+
+func newSessionHub() *sessionHub {
+	return &sessionHub{byName: make(map[string]map[string]*session)}
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// join opens a new session for name. What happens if name already has sessions depends on mode.
+// The second return value is true if this is the only session of the bidder.
+func (h *sessionHub) join(name string, mode gRPC.JoinMode, stream gRPC.AuctionSystem_JoinServer) (*session, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	existing := h.byName[name]
+	if len(existing) > 0 {
+		switch mode {
+		case gRPC.JoinMode_ATTACH:
+		case gRPC.JoinMode_TAKEOVER:
+			for id, old := range existing {
+				slog.Info("session taken over", "bidder", name, "session", id)
+				old.reason = status.Error(codes.Aborted, "your session was taken over by another device")
+				close(old.closed)
+				delete(existing, id)
+				subscribers.Add(-1)
+			}
+		default:
+			return nil, false, errNameTaken
+		}
+	}
+	if existing == nil {
+		existing = make(map[string]*session)
+		h.byName[name] = existing
+	}
+
+	s := &session{
+		id:     newSessionID(),
+		name:   name,
+		stream: stream,
+		closed: make(chan struct{}),
+	}
+	existing[s.id] = s
+	subscribers.Add(1)
+	return s, len(existing) == 1, nil
+}
+
+// leave removes the session, and returns true if it was the bidders last one.
+// Leaving a session that was taken over does nothing.
+func (h *sessionHub) leave(s *session) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	existing := h.byName[s.name]
+	if _, ok := existing[s.id]; !ok {
+		return false
+	}
+	delete(existing, s.id)
+	subscribers.Add(-1)
+	if len(existing) == 0 {
+		delete(h.byName, s.name)
+		return true
+	}
+	return false
+}
+
+// closeAll ends every session, their Join calls return reason
+func (h *sessionHub) closeAll(reason error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name, sessions := range h.byName {
+		for _, s := range sessions {
+			s.reason = reason
+			close(s.closed)
+			subscribers.Add(-1)
+		}
+		delete(h.byName, name)
+	}
+}
+
+// closeBidder ends every session of name, their Join calls return reason
+func (h *sessionHub) closeBidder(name string, reason error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range h.byName[name] {
+		s.reason = reason
+		close(s.closed)
+		subscribers.Add(-1)
+	}
+	delete(h.byName, name)
+}
+
+// the sessions of name, or of everyone if name is empty
+func (h *sessionHub) sessions(name string) []*session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var list []*session
+	for bidder, sessions := range h.byName {
+		if name != "" && bidder != name {
+			continue
+		}
+		for _, s := range sessions {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// sends a message to every session of a specific bidder
+func (h *sessionHub) sendTo(name string, message *gRPC.Message) {
+	for _, s := range h.sessions(name) {
+		s.send(message)
+	}
+}
+
+// sends a message to every session
+func (h *sessionHub) sendToAll(ctx context.Context, message *gRPC.Message) {
+	defer broadcastSeconds.ObserveSince(time.Now())
+	sessions := h.sessions("")
+	_, span := tracing.Start(ctx, "broadcast", tracing.Internal, "sessions", len(sessions))
+	defer span.End(nil)
+	for _, s := range sessions {
+		s.send(message)
+	}
+}
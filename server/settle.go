@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbjnitu/AuctionSystem-replication/audit"
+	"github.com/mbjnitu/AuctionSystem-replication/logging"
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Settling a closed auction happens in two parts. Every replica makes the same order for the winning bid
+// and tells the winner and the losers, like it does with every other message. The hooks, that reach outside
+// the cluster, must only run once, so the live replica with the lowest -replica number claims the auction from
+// its peers. With a majority of the cluster behind it, it runs the hooks and tells the peers the auction is
+// settled. The others wait two leases and then try to claim the auction themselves, in case the first one went
+// down. If a replica goes down between running the hooks and telling its peers, they run again. A hook that
+// fails is tried again in the background by the replica that settled the auction, and if it keeps failing the
+// order goes to the dead letter file, so it can be dealt with by hand.
+
+// a claim a replica holds on settling an auction
+type claim struct {
+	holder string
+	until  time.Time
+}
+
+// settler settles the closed auctions of this replica
+type settler struct {
+	self     string                        // the name of this replica, ex. "replica 0"
+	peers    map[string]gRPC.ReplicaClient // by address
+	sessions *sessionHub
+	hooks    []settlementHook
+	backoff  time.Duration  // how long to wait before trying a failed hook again the first time
+	inFlight sync.WaitGroup // the auctions this replica has claimed and is settling
+
+	mu       sync.Mutex
+	retrying map[string]*gRPC.Order // the orders with hooks that are being tried again, by order and hook
+	deadFile string
+}
+
+var settlement *settler
+
+func newSettler(self string, peers map[string]*grpc.ClientConn, sessions *sessionHub) *settler {
+	s := &settler{
+		self:     self,
+		peers:    map[string]gRPC.ReplicaClient{},
+		sessions: sessions,
+		hooks:    loadHooks(),
+		backoff:  time.Second,
+		retrying: map[string]*gRPC.Order{},
+		deadFile: *settleDeadLetter,
+	}
+	for addr, conn := range peers {
+		s.peers[addr] = gRPC.NewReplicaClient(conn)
+	}
+	return s
+}
+
+// closed makes the order for the winning bid, tells the bidders how it went and starts settling the auction.
+// Must be called holding auctionMu, after the auction has become CLOSED.
+func (s *settler) closed(ctx context.Context, a *auction) {
+	if a.bidder == "" {
+		// there is nothing to settle, every replica can do it by itself
+		s.settle(ctx, a, s.self, time.Now(), "there were no bids")
+		return
+	}
+
+	a.order = &gRPC.Order{Id: "order-" + a.id, Auction: a.id, Winner: a.bidder, Amount: a.amount, ClosedAt: time.Now().UnixMilli()}
+	s.sessions.sendTo(a.bidder, &gRPC.Message{
+		Sender:  "Server",
+		Message: "You won the auction " + a.id + ", your order is " + a.order.Id + ", at the price: ",
+		Bid:     a.amount,
+		Auction: a.id,
+	})
+	told := map[string]bool{a.bidder: true}
+	for _, bid := range a.bids {
+		if told[bid.Bidder] {
+			continue
+		}
+		told[bid.Bidder] = true
+		s.sessions.sendTo(bid.Bidder, &gRPC.Message{
+			Sender:  "Server",
+			Message: "You did not win the auction " + a.id + ", it went for: ",
+			Bid:     a.amount,
+			Auction: a.id,
+		})
+	}
+	s.schedule(a)
+}
+
+// schedule tries to settle the auction now if this replica is the one to do it, and later if not.
+// Must be called holding auctionMu.
+func (s *settler) schedule(a *auction) {
+	wait := 2 * *settleLease
+	if firstLive() {
+		wait = 0
+	}
+	id := a.id
+	time.AfterFunc(wait, func() { s.trySettle(id) })
+}
+
+// trySettle claims the auction from the peers, and if a majority agrees runs the hooks and settles it
+func (s *settler) trySettle(id string) {
+	ctx := logging.With(logging.WithRequestID(context.Background(), logging.NewRequestID()), "auction", id)
+
+	auctionMu.Lock()
+	a, ok := auctions[id]
+	if !ok || a.state != gRPC.AuctionState_CLOSED || isDraining() {
+		auctionMu.Unlock()
+		return
+	}
+	if !serving() {
+		auctionMu.Unlock()
+		time.AfterFunc(*settleLease, func() { s.trySettle(id) })
+		return
+	}
+	if !a.claim.granted(s.self) {
+		// a peer is settling it, if it has not managed to once the claim runs out this replica tries
+		retry := time.Until(a.claim.until) + *settleLease
+		auctionMu.Unlock()
+		time.AfterFunc(retry, func() { s.trySettle(id) })
+		return
+	}
+	a.claim = claim{holder: s.self, until: time.Now().Add(*settleLease)}
+	order := &gRPC.Order{Id: a.order.Id, Auction: a.order.Auction, Winner: a.order.Winner, Amount: a.order.Amount, ClosedAt: a.order.ClosedAt}
+	// a replica that starts shutting down from here on lets it finish, see handOver
+	s.inFlight.Add(1)
+	defer s.inFlight.Done()
+	auctionMu.Unlock()
+
+	granted, settled := s.claimFromPeers(ctx, id)
+	if settled != nil {
+		// a peer settled it while this replica was not listening
+		auctionMu.Lock()
+		if a.state == gRPC.AuctionState_CLOSED {
+			s.settle(ctx, a, settled.Holder, time.UnixMilli(settled.SettledAt), "")
+		}
+		auctionMu.Unlock()
+		return
+	}
+	if granted < (len(s.peers)+1)/2+1 {
+		slog.InfoContext(ctx, "could not claim the settlement, trying again later", "granted", granted)
+		time.AfterFunc(*settleLease, func() { s.trySettle(id) })
+		return
+	}
+
+	// the hooks have to be done before the claim runs out, or a peer could run them as well
+	settledAt := time.Now()
+	order.SettledAt, order.SettledBy = settledAt.UnixMilli(), s.self
+	hookCtx, cancel := context.WithTimeout(ctx, *settleLease/2)
+	s.runHooks(hookCtx, order)
+	cancel()
+
+	auctionMu.Lock()
+	if a.state == gRPC.AuctionState_CLOSED {
+		s.settle(ctx, a, s.self, settledAt, "")
+	}
+	auctionMu.Unlock()
+
+	for addr, peer := range s.peers {
+		peerCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		_, err := peer.Settled(peerCtx, &gRPC.SettledRequest{Auction: id, SettledBy: s.self, SettledAt: settledAt.UnixMilli()})
+		cancel()
+		if err != nil {
+			// it finds out when it tries to claim the auction, or from the snapshot if it restarts
+			slog.WarnContext(ctx, "could not tell a peer the auction is settled", "peer", addr, "err", err)
+		}
+	}
+}
+
+// asks every peer at once to grant this replica the claim, and returns how many did, counting this replica,
+// and the answer of a peer that has already settled the auction
+func (s *settler) claimFromPeers(ctx context.Context, id string) (granted int, settled *gRPC.ClaimSettlementResponse) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	granted = 1
+	for addr, peer := range s.peers {
+		wg.Add(1)
+		go func(addr string, peer gRPC.ReplicaClient) {
+			defer wg.Done()
+			peerCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			response, err := peer.ClaimSettlement(peerCtx, &gRPC.ClaimSettlementRequest{Auction: id, Claimant: s.self, LeaseMs: settleLease.Milliseconds()})
+			if err != nil {
+				slog.DebugContext(ctx, "peer did not answer the claim", "peer", addr, "err", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if response.Granted {
+				granted++
+			}
+			if response.Settled {
+				settled = response
+			}
+		}(addr, peer)
+	}
+	wg.Wait()
+	return granted, settled
+}
+
+// runHooks runs every hook once, the ones that fail are tried again in the background
+func (s *settler) runHooks(ctx context.Context, order *gRPC.Order) {
+	for _, hook := range s.hooks {
+		err := hook.run(ctx, order)
+		if err != nil {
+			hooksTotal.Inc(hook.name(), "failed")
+			if *settleAttempts <= 1 {
+				hooksTotal.Inc(hook.name(), "dead")
+				slog.ErrorContext(ctx, "settlement hook failed", "hook", hook.name(), "err", err)
+				s.deadLetter(hook.name(), order, 1, err)
+				continue
+			}
+			slog.WarnContext(ctx, "settlement hook failed, trying again", "hook", hook.name(), "in", s.backoff, "err", err)
+			key := order.Id + "/" + hook.name()
+			s.mu.Lock()
+			s.retrying[key] = order
+			s.mu.Unlock()
+			go s.retryHook(logging.With(context.WithoutCancel(ctx), "hook", hook.name()), hook, order, key)
+			continue
+		}
+		hooksTotal.Inc(hook.name(), "ok")
+		slog.InfoContext(ctx, "settlement hook ran", "hook", hook.name())
+	}
+}
+
+// retryHook runs a hook that failed again with exponential backoff, until it works or -settle-attempts are
+// used up. Then the order goes to the dead letter file.
+func (s *settler) retryHook(ctx context.Context, hook settlementHook, order *gRPC.Order, key string) {
+	backoff := s.backoff
+	for attempt := 2; ; attempt++ {
+		time.Sleep(backoff)
+		hookCtx, cancel := context.WithTimeout(ctx, *settleLease/2)
+		err := hook.run(hookCtx, order)
+		cancel()
+		if err == nil {
+			hooksTotal.Inc(hook.name(), "ok")
+			slog.InfoContext(ctx, "settlement hook ran", "attempt", attempt)
+			s.done(key)
+			return
+		}
+		hooksTotal.Inc(hook.name(), "failed")
+		if attempt >= *settleAttempts {
+			hooksTotal.Inc(hook.name(), "dead")
+			slog.ErrorContext(ctx, "settlement hook failed, giving up", "attempts", attempt, "err", err)
+			if s.done(key) {
+				s.deadLetter(hook.name(), order, attempt, err)
+			}
+			return
+		}
+		backoff = min(2*backoff, time.Minute)
+		slog.WarnContext(ctx, "settlement hook failed, trying again", "attempt", attempt, "in", backoff, "err", err)
+	}
+}
+
+// done stops retrying the hook, and reports if it was still being retried, rather than given up on by flush
+func (s *settler) done(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.retrying[key]
+	delete(s.retrying, key)
+	return ok
+}
+
+// flush gives up on the hooks that are being tried again, and puts their orders in the dead letter file,
+// so they are not lost when the replica shuts down
+func (s *settler) flush() {
+	s.mu.Lock()
+	retrying := s.retrying
+	s.retrying = map[string]*gRPC.Order{}
+	s.mu.Unlock()
+	for key, order := range retrying {
+		hook := strings.TrimPrefix(key, order.Id+"/")
+		s.deadLetter(hook, order, 0, errors.New("the replica shut down before the hook ran"))
+	}
+}
+
+// appends an order whose hook could not be run to the dead letter file, as a line of json
+func (s *settler) deadLetter(hook string, order *gRPC.Order, attempts int, reason error) {
+	data, _ := orderJSON.Marshal(order)
+	line, _ := json.Marshal(struct {
+		Hook     string          `json:"hook"`
+		Order    json.RawMessage `json:"order"`
+		Attempts int             `json:"attempts"`
+		Error    string          `json:"error"`
+		Time     time.Time       `json:"time"`
+	}{hook, data, attempts, reason.Error(), time.Now().UTC()})
+
+	file, err := os.OpenFile(s.deadFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Error("failed to open the settlement dead letter file", "file", s.deadFile, "err", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Error("failed to write to the settlement dead letter file", "file", s.deadFile, "err", err)
+	}
+}
+
+// handOver lets the peers take over settling before the replica shuts down. It waits for the auctions being
+// settled, gives up the claims this replica holds and tells the peers it is leaving, so they do not wait for
+// the leases to run out. Must be called once the replica is draining, so it claims no more auctions.
+func (s *settler) handOver() {
+	settling := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(settling)
+	}()
+	select {
+	case <-settling:
+	case <-time.After(*settleLease):
+		slog.Warn("auctions are still being settled, handing over anyway", "waited", *settleLease)
+	}
+
+	auctionMu.Lock()
+	for _, a := range auctions {
+		if a.claim.holder == s.self {
+			a.claim = claim{}
+		}
+	}
+	auctionMu.Unlock()
+
+	for addr, peer := range s.peers {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := peer.Leaving(ctx, &gRPC.LeavingRequest{Replica: int32(*replicaFlag), Claimant: s.self})
+		cancel()
+		if err != nil {
+			// it finds out from the health of this replica, and waits for the leases to run out
+			slog.Warn("could not tell a peer this replica is leaving", "peer", addr, "err", err)
+		}
+	}
+}
+
+// settle marks the auction as settled. Must be called holding auctionMu.
+func (s *settler) settle(ctx context.Context, a *auction, by string, at time.Time, reason string) {
+	if a.order != nil {
+		a.order.SettledAt = at.UnixMilli()
+		a.order.SettledBy = by
+	}
+	if reason == "" {
+		reason = "settled by " + by
+	}
+	err := transition(ctx, a, gRPC.AuctionState_SETTLED, reason, s.sessions, &gRPC.Message{
+		Message: "The auction " + a.id + " has been settled",
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "could not settle the auction", "err", err)
+		return
+	}
+	a.claim = claim{}
+	record(ctx, audit.Entry{Event: audit.Settled, Auction: a.id, Bidder: a.bidder, Amount: a.amount, Reason: reason})
+}
+
+// granted reports if the claim may be given to claimant, because nobody else holds it
+func (c claim) granted(claimant string) bool {
+	return c.holder == "" || c.holder == claimant || time.Now().After(c.until)
+}
+
+func (r *replica) ClaimSettlement(ctx context.Context, request *gRPC.ClaimSettlementRequest) (*gRPC.ClaimSettlementResponse, error) {
+	if err := checkPeerCertificate(ctx); err != nil {
+		return nil, err
+	}
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	a, ok := auctions[request.Auction]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "there is no auction %q", request.Auction)
+	}
+	if a.state == gRPC.AuctionState_SETTLED {
+		response := &gRPC.ClaimSettlementResponse{Settled: true}
+		if a.order != nil {
+			response.Holder, response.SettledAt = a.order.SettledBy, a.order.SettledAt
+		}
+		return response, nil
+	}
+	// the claim is granted even if this replica has not closed the auction yet, its clock may be a little behind
+	if a.state == gRPC.AuctionState_CANCELLED || !a.claim.granted(request.Claimant) {
+		return &gRPC.ClaimSettlementResponse{Holder: a.claim.holder}, nil
+	}
+	a.claim = claim{holder: request.Claimant, until: time.Now().Add(time.Duration(request.LeaseMs) * time.Millisecond)}
+	return &gRPC.ClaimSettlementResponse{Granted: true}, nil
+}
+
+func (r *replica) Settled(ctx context.Context, request *gRPC.SettledRequest) (*gRPC.SettledResponse, error) {
+	if err := checkPeerCertificate(ctx); err != nil {
+		return nil, err
+	}
+	ctx = logging.With(ctx, "auction", request.Auction)
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	a, ok := auctions[request.Auction]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "there is no auction %q", request.Auction)
+	}
+	if a.state != gRPC.AuctionState_CLOSED {
+		// already settled, or not closed here yet, then trySettle finds out from the peers later
+		return &gRPC.SettledResponse{}, nil
+	}
+	if !isDraining() {
+		settlement.settle(ctx, a, request.SettledBy, time.UnixMilli(request.SettledAt), "")
+	}
+	return &gRPC.SettledResponse{}, nil
+}
+
+func (r *replica) Leaving(ctx context.Context, request *gRPC.LeavingRequest) (*gRPC.LeavingResponse, error) {
+	if err := checkPeerCertificate(ctx); err != nil {
+		return nil, err
+	}
+	// the health watch finds out as well, but maybe only after the claims below have been scheduled
+	healthMu.Lock()
+	for addr, id := range peerIDs {
+		if id == int(request.Replica) {
+			livePeers[addr] = false
+			slog.InfoContext(ctx, "peer is leaving", "peer", addr, "peer_replica", id)
+		}
+	}
+	healthMu.Unlock()
+	updateHealth()
+	webhooks.checkSender()
+
+	auctionMu.Lock()
+	defer auctionMu.Unlock()
+	for _, a := range sortedAuctions() {
+		if a.claim.holder != request.Claimant {
+			continue
+		}
+		a.claim = claim{}
+		if a.state == gRPC.AuctionState_CLOSED {
+			settlement.schedule(a)
+		}
+	}
+	return &gRPC.LeavingResponse{}, nil
+}
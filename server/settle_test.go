@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gRPC "github.com/mbjnitu/AuctionSystem-replication/proto"
+)
+
+// failingHook fails the first failures times it is run
+type failingHook struct {
+	mu       sync.Mutex
+	failures int
+	runs     int
+}
+
+func (h *failingHook) name() string { return "failing" }
+
+func (h *failingHook) run(ctx context.Context, order *gRPC.Order) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs++
+	if h.runs <= h.failures {
+		return errors.New("not now")
+	}
+	return nil
+}
+
+func (h *failingHook) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.runs
+}
+
+func TestRunHooksRetries(t *testing.T) {
+	oldAttempts := *settleAttempts
+	defer func() { *settleAttempts = oldAttempts }()
+
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+		wantRuns int
+		wantDead bool
+	}{
+		{"works the first time", 0, 3, 1, false},
+		{"works the second time", 1, 3, 2, false},
+		{"works the last time", 2, 3, 3, false},
+		{"keeps failing", 5, 3, 3, true},
+		{"no retries", 5, 1, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*settleAttempts = test.attempts
+			hook := &failingHook{failures: test.failures}
+			s := &settler{
+				hooks:    []settlementHook{hook},
+				backoff:  time.Millisecond,
+				retrying: map[string]*gRPC.Order{},
+				deadFile: filepath.Join(t.TempDir(), "settle-dead.jsonl"),
+			}
+			s.runHooks(context.Background(), &gRPC.Order{Id: "order-car", Auction: "car", Winner: "alice", Amount: 100})
+
+			deadline := time.Now().Add(5 * time.Second)
+			for hook.count() < test.wantRuns && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			// the last retry writes the dead letter after it has run
+			time.Sleep(50 * time.Millisecond)
+			if got := hook.count(); got != test.wantRuns {
+				t.Errorf("hook ran %d times, want %d", got, test.wantRuns)
+			}
+			data, _ := os.ReadFile(s.deadFile)
+			if dead := strings.Contains(string(data), `"order-car"`); dead != test.wantDead {
+				t.Errorf("order in the dead letter file = %v, want %v: %s", dead, test.wantDead, data)
+			}
+		})
+	}
+}
+
+func TestFlushRetryingHooks(t *testing.T) {
+	oldAttempts := *settleAttempts
+	defer func() { *settleAttempts = oldAttempts }()
+	*settleAttempts = 3
+
+	hook := &failingHook{failures: 5}
+	s := &settler{
+		hooks:    []settlementHook{hook},
+		backoff:  time.Hour,
+		retrying: map[string]*gRPC.Order{},
+		deadFile: filepath.Join(t.TempDir(), "settle-dead.jsonl"),
+	}
+	s.runHooks(context.Background(), &gRPC.Order{Id: "order-car", Auction: "car"})
+	s.flush()
+
+	data, _ := os.ReadFile(s.deadFile)
+	if !strings.Contains(string(data), `"hook":"failing"`) || !strings.Contains(string(data), `"order-car"`) {
+		t.Errorf("dead letter file = %s, want the order of the failing hook", data)
+	}
+}
+
+// a peer that is leaving gives up its claims, and the replica stops counting it as live
+func TestLeaving(t *testing.T) {
+	oldLive, oldHeard, oldIDs, oldReplica, oldLease, oldAuctions, oldSettlement := livePeers, heardFrom, peerIDs, *replicaFlag, *settleLease, auctions, settlement
+	defer func() {
+		livePeers, heardFrom, peerIDs, *replicaFlag, *settleLease, auctions, settlement = oldLive, oldHeard, oldIDs, oldReplica, oldLease, oldAuctions, oldSettlement
+		updateHealth()
+	}()
+	*replicaFlag = 1
+	// long enough that the replica does not try to settle the auctions during the test
+	*settleLease = time.Hour
+	livePeers = map[string]bool{"localhost:5000": true, "localhost:5002": true}
+	heardFrom = map[string]bool{"localhost:5000": true, "localhost:5002": true}
+	peerIDs = map[string]int{"localhost:5000": 0, "localhost:5002": 2}
+	settlement = &settler{self: "replica 1"}
+	until := time.Now().Add(time.Hour)
+	auctions = map[string]*auction{
+		"car":   {id: "car", state: gRPC.AuctionState_CLOSED, claim: claim{holder: "replica 2", until: until}},
+		"boat":  {id: "boat", state: gRPC.AuctionState_CLOSED, claim: claim{holder: "replica 0", until: until}},
+		"plane": {id: "plane", state: gRPC.AuctionState_OPEN},
+	}
+
+	if _, err := (&replica{}).Leaving(context.Background(), &gRPC.LeavingRequest{Replica: 2, Claimant: "replica 2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if livePeers["localhost:5002"] {
+		t.Error("the peer that left is still live")
+	}
+	if !livePeers["localhost:5000"] {
+		t.Error("the peer that stays is no longer live")
+	}
+	if holder := auctions["car"].claim.holder; holder != "" {
+		t.Errorf("claim of the peer that left is held by %q, want it given up", holder)
+	}
+	if holder := auctions["boat"].claim.holder; holder != "replica 0" {
+		t.Errorf("claim of the peer that stays is held by %q, want replica 0", holder)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// closed when the replica starts shutting down
+var goingAway = make(chan struct{})
+
+// shuts the replica down gracefully on SIGINT (ctrl+c) or SIGTERM
+func handleSignals(grpcServer *grpc.Server, sessions *sessionHub) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	// a second signal kills the replica right away, in case shutting down hangs
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+
+	fmt.Println("Server is shutting down")
+	slog.Info("shutting down", "signal", sig.String())
+	shutdown(grpcServer, sessions)
+}
+
+// shutdown stops the replica without losing bids or leaving bidders hanging:
+// new bids and joins are turned down, the bid being handled is finished, the bidders are told the
+// server is going away, the webhooks and settlements are handed over to the peers, the audit log is
+// flushed and then the calls still running are let finish.
+func shutdown(grpcServer *grpc.Server, sessions *sessionHub) {
+	// peers and clients see the replica as NOT_SERVING from here on, and stop counting on it
+	healthMu.Lock()
+	draining = true
+	healthMu.Unlock()
+	updateHealth()
+
+	// waits for the bid that is being handled, bids after it see the replica is draining
+	auctionMu.Lock()
+	auctionMu.Unlock()
+
+	sessions.closeAll(status.Error(codes.Unavailable, "server going away"))
+	close(goingAway)
+
+	// the peers take over before this replica stops answering them
+	webhooks.handOver()
+	if settlement != nil {
+		settlement.handOver()
+		settlement.flush()
+	}
+	if err := auditLog.Close(); err != nil {
+		slog.Error("failed to flush the audit log", "err", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		slog.Info("server stopped")
+	case <-time.After(*shutdownTimeout):
+		slog.Warn("calls did not finish in time, stopping anyway", "timeout", *shutdownTimeout)
+		grpcServer.Stop()
+	}
+}
+
+// healthService is the health server, except that Watch streams end when the replica shuts down,
+// so they do not keep GracefulStop waiting
+type healthService struct {
+	*health.Server
+}
+
+func (h healthService) Watch(request *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-goingAway:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return h.Server.Watch(request, &watchStream{Health_WatchServer: stream, ctx: ctx})
+}
+
+type watchStream struct {
+	healthpb.Health_WatchServer
+	ctx context.Context
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
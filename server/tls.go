@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mbjnitu/AuctionSystem-replication/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// tlsEnabled reports if the server was started with a certificate
+func tlsEnabled() bool {
+	return *tlsCertFile != ""
+}
+
+// reads a pem file with one or more CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// serverCredentials makes the transport credentials for the listening port.
+// Bidders only have to trust the servers certificate, while a peer that presents a client
+// certificate has it verified against the CA, so replicas can talk to each other over mTLS on the same port.
+func serverCredentials() (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if *tlsCAFile != "" {
+		pool, err := loadCertPool(*tlsCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// checkPeerCertificate makes sure the caller is another replica, by the client certificate it presented.
+// The CA signs the certificates of bidders as well, so being signed by it is not enough: the certificate also
+// has to be for server auth, which only the certificates of replicas are.
+// Without mTLS there is nothing to check, and every caller is let through.
+func checkPeerCertificate(ctx context.Context) error {
+	if !tlsEnabled() || *tlsCAFile == "" {
+		return nil
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			if isReplicaCertificate(info.State.VerifiedChains[0][0]) {
+				return nil
+			}
+		}
+	}
+	return status.Error(codes.PermissionDenied, "only replicas with a server certificate from the CA may call this")
+}
+
+// reports if the certificate is one a replica serves with, and not one of a bidder
+func isReplicaCertificate(cert *x509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
+
+// peerCredentials makes the credentials used when dialing another replica.
+// The replica presents its own certificate and only accepts peers signed by the CA.
+func peerCredentials() (credentials.TransportCredentials, error) {
+	if !tlsEnabled() {
+		return insecure.NewCredentials(), nil
+	}
+	if *tlsCAFile == "" {
+		return nil, errors.New("mTLS between replicas needs -tls-ca")
+	}
+	cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := loadCertPool(*tlsCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}), nil
+}
+
+// connects to the other replicas given with -peers. The connections are made in the
+// background, so a replica can start before its peers are up.
+func connectToPeers() (map[string]*grpc.ClientConn, error) {
+	peers := make(map[string]*grpc.ClientConn)
+	if *peerAddrs == "" {
+		return peers, nil
+	}
+
+	creds, err := peerCredentials()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range strings.Split(*peerAddrs, ",") {
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds),
+			grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor),
+			grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor))
+		if err != nil {
+			return nil, err
+		}
+		conn.Connect()
+		peers[addr] = conn
+		peerUp.Set(0, addr)
+		livePeers[addr] = false
+		go watchPeer(addr, conn)
+		go watchPeerHealth(addr, conn)
+	}
+	return peers, nil
+}
+
+// logs whenever the connection to a peer goes up or down
+func watchPeer(addr string, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	for conn.WaitForStateChange(context.Background(), state) {
+		state = conn.GetState()
+		if state == connectivity.Ready {
+			peerUp.Set(1, addr)
+		} else {
+			peerUp.Set(0, addr)
+		}
+		if state == connectivity.Ready || state == connectivity.TransientFailure {
+			slog.Info("peer connection changed", "peer", addr, "state", state.String())
+		}
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// makes a certificate for name signed by a new CA, with the usages certgen gives it
+func testCertificate(t *testing.T, name string, usage ...x509.ExtKeyUsage) []*x509.Certificate {
+	t.Helper()
+	newCert := func(template, parent *x509.Certificate, key *ecdsa.PrivateKey, signer *ecdsa.PrivateKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := newCert(caTemplate, caTemplate, caKey, caKey)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usage,
+	}, ca, key, caKey)
+	return []*x509.Certificate{leaf, ca}
+}
+
+func TestCheckPeerCertificate(t *testing.T) {
+	oldCert, oldCA := *tlsCertFile, *tlsCAFile
+	*tlsCertFile, *tlsCAFile = "server0.pem", "ca.pem"
+	defer func() { *tlsCertFile, *tlsCAFile = oldCert, oldCA }()
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		want  codes.Code
+	}{
+		{"replica", testCertificate(t, "server1", x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth), codes.OK},
+		{"bidder", testCertificate(t, "client-alice", x509.ExtKeyUsageClientAuth), codes.PermissionDenied},
+		{"no certificate", nil, codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := tls.ConnectionState{}
+			if test.chain != nil {
+				state.VerifiedChains = [][]*x509.Certificate{test.chain}
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{
+				Addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+				AuthInfo: credentials.TLSInfo{State: state},
+			})
+			if got := status.Code(checkPeerCertificate(ctx)); got != test.want {
+				t.Errorf("checkPeerCertificate() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The events that webhooks can subscribe to. Auction events are named after the state the auction went to.
+var webhookEvents = []string{
+	"bid.accepted", "bid.retracted",
+	"auction.scheduled", "auction.open", "auction.paused", "auction.closing", "auction.closed", "auction.settled", "auction.cancelled",
+}
+
+// Subscription is a url that auction events are posted to, signed with the secret.
+type Subscription struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"` // ex. "bid.accepted" or "auction.*", empty for every event
+
+	queue chan WebhookEvent
+}
+
+// WebhookEvent is the json that is posted. The id is the same on every replica, so a receiver can drop the
+// rare event it gets twice, ex. when the replica that sends the events changes.
+type WebhookEvent struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Auction string    `json:"auction"`
+	Bidder  string    `json:"bidder,omitempty"`
+	Amount  int64     `json:"amount,omitempty"`
+	From    string    `json:"from,omitempty"` // the old state of auction events
+	To      string    `json:"to,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// webhookSender posts auction events to the subscriptions. Only the live replica with the lowest -replica number
+// sends them, the others keep the events of the last -webhook-handover so they can send them if they
+// take over. A nil sender means no webhooks were configured.
+type webhookSender struct {
+	subscriptions []*Subscription
+
+	mu       sync.Mutex
+	sending  bool           // if this replica is the one that sends the events
+	recent   []WebhookEvent // the events of the last -webhook-handover, oldest first
+	deadFile string
+}
+
+var webhooks *webhookSender
+
+// loads the subscriptions from a json file, ex.
+// [{"url": "http://localhost:8080/events", "secret": "...", "events": ["bid.accepted", "auction.closed"]}]
+func loadWebhooks(path string) (*webhookSender, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var subscriptions []*Subscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, sub := range subscriptions {
+		u, err := url.Parse(sub.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("subscription %d: %q is not an http or https url", i, sub.URL))
+		}
+		if len(sub.Secret) < 16 {
+			errs = append(errs, fmt.Errorf("subscription %d: the secret must be at least 16 bytes", i))
+		}
+		for _, pattern := range sub.Events {
+			if !knownEvent(pattern) {
+				errs = append(errs, fmt.Errorf("subscription %d: unknown event %q, use one of %s", i, pattern, strings.Join(webhookEvents, ", ")))
+			}
+		}
+		sub.queue = make(chan WebhookEvent, 1000)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &webhookSender{subscriptions: subscriptions, deadFile: *webhookDeadLetter}, nil
+}
+
+// knownEvent reports if pattern matches at least one event
+func knownEvent(pattern string) bool {
+	for _, event := range webhookEvents {
+		if matchEvent(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEvent reports if the event is picked by the pattern, which is an event or ends with "*"
+func matchEvent(pattern string, event string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(event, prefix)
+	}
+	return pattern == event
+}
+
+func (sub *Subscription) wants(event string) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, pattern := range sub.Events {
+		if matchEvent(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// start delivers the events of every subscription in the background, and checks once a second if this
+// replica is the one that sends them
+func (w *webhookSender) start() {
+	for _, sub := range w.subscriptions {
+		go w.deliverAll(sub)
+	}
+	go func() {
+		for range time.Tick(time.Second) {
+			w.checkSender()
+		}
+	}()
+}
+
+// checkSender makes this replica send the events if it has become the first live replica, and sends the
+// events of the last -webhook-handover again, as the replica that sent them before may not have. Until the
+// health of every peer is known every replica could think it is the first, so none of them sends yet.
+func (w *webhookSender) checkSender() {
+	if w == nil {
+		return
+	}
+	first := peersKnown() && firstLive() && serving()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if first == w.sending {
+		return
+	}
+	w.sending = first
+	if !first {
+		slog.Info("another replica sends the webhooks now")
+		return
+	}
+	slog.Info("this replica sends the webhooks now", "resending", len(w.recent))
+	w.prune()
+	for _, event := range w.recent {
+		w.enqueue(event)
+	}
+}
+
+// handOver stops sending the events before the replica shuts down. The peer that comes next takes over once it
+// hears this replica is leaving, and sends the events of the last -webhook-handover again.
+func (w *webhookSender) handOver() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sending {
+		w.sending = false
+		slog.Info("handing the webhooks over to the next replica")
+	}
+}
+
+// emit sends the event to the subscriptions that want it, if this replica is the one that sends them.
+// It does not block, so it can be called holding auctionMu.
+func (w *webhookSender) emit(event WebhookEvent) {
+	if w == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.recent = append(w.recent, event)
+	w.prune()
+	if w.sending {
+		w.enqueue(event)
+	}
+}
+
+// drops the events older than -webhook-handover. Must be called holding w.mu.
+func (w *webhookSender) prune() {
+	cutoff := time.Now().Add(-*webhookHandover)
+	i := 0
+	for i < len(w.recent) && w.recent[i].Time.Before(cutoff) {
+		i++
+	}
+	w.recent = w.recent[i:]
+}
+
+// Must be called holding w.mu.
+func (w *webhookSender) enqueue(event WebhookEvent) {
+	for _, sub := range w.subscriptions {
+		if !sub.wants(event.Type) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			webhooksTotal.Inc("dead")
+			w.deadLetter(sub, event, 0, errors.New("too many events waiting to be delivered"))
+		}
+	}
+}
+
+func (w *webhookSender) deliverAll(sub *Subscription) {
+	for event := range sub.queue {
+		w.deliver(sub, event)
+	}
+}
+
+// deliver posts the event, trying again with exponential backoff until it is taken, it is turned down for
+// good, or -webhook-attempts are used up. Events that are not delivered go to the dead letter file.
+func (w *webhookSender) deliver(sub *Subscription, event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode webhook event", "err", err)
+		return
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := post(sub, event, body)
+		if err == nil {
+			webhooksTotal.Inc("delivered")
+			slog.Debug("webhook delivered", "url", sub.URL, "event", event.ID, "attempt", attempt)
+			return
+		}
+		if !retry || attempt >= *webhookAttempts {
+			webhooksTotal.Inc("dead")
+			slog.Warn("webhook not delivered", "url", sub.URL, "event", event.ID, "attempts", attempt, "err", err)
+			w.deadLetter(sub, event, attempt, err)
+			return
+		}
+		webhooksTotal.Inc("retried")
+		slog.Info("webhook failed, trying again", "url", sub.URL, "event", event.ID, "attempt", attempt, "in", backoff, "err", err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// posts the event once, and reports if a failure is worth trying again
+func post(sub *Subscription, event WebhookEvent, body []byte) (retry bool, err error) {
+	request, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Auction-Event", event.Type)
+	request.Header.Set("X-Auction-Event-Id", event.ID)
+	request.Header.Set("X-Auction-Timestamp", timestamp)
+	request.Header.Set("X-Auction-Signature", "sha256="+sign(sub.Secret, timestamp, body))
+
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+	switch {
+	case response.StatusCode/100 == 2:
+		return false, nil
+	case response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests || response.StatusCode/100 == 5:
+		return true, fmt.Errorf("answered %s", response.Status)
+	default:
+		// the receiver does not want it, sending it again will not change that
+		return false, fmt.Errorf("answered %s", response.Status)
+	}
+}
+
+// sign is the hex HMAC-SHA256 of "[timestamp].[body]" with the secret, the timestamp is signed so a
+// receiver can turn down old requests that are sent again
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appends an event that could not be delivered to the dead letter file, as a line of json
+func (w *webhookSender) deadLetter(sub *Subscription, event WebhookEvent, attempts int, reason error) {
+	line, _ := json.Marshal(struct {
+		URL      string       `json:"url"`
+		Event    WebhookEvent `json:"event"`
+		Attempts int          `json:"attempts"`
+		Error    string       `json:"error"`
+		Time     time.Time    `json:"time"`
+	}{sub.URL, event, attempts, reason.Error(), time.Now().UTC()})
+
+	file, err := os.OpenFile(w.deadFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Error("failed to open the webhook dead letter file", "file", w.deadFile, "err", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Error("failed to write to the webhook dead letter file", "file", w.deadFile, "err", err)
+	}
+}
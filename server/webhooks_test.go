@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// a replica does not send webhooks before it knows the health of its peers, as a peer with a lower number
+// that is up would send them as well
+func TestWebhookSenderWaitsForPeerHealth(t *testing.T) {
+	oldLive, oldHeard, oldIDs, oldRecovering, oldHandover, oldReplica := livePeers, heardFrom, peerIDs, recovering, *webhookHandover, *replicaFlag
+	defer func() {
+		livePeers, heardFrom, peerIDs, recovering, *webhookHandover, *replicaFlag = oldLive, oldHeard, oldIDs, oldRecovering, oldHandover, oldReplica
+		updateHealth()
+	}()
+	*webhookHandover = time.Minute
+	*replicaFlag = 1
+	// the peers are known by addresses that sort the other way around from their numbers
+	peerIDs = map[string]int{"localhost:5000": 2, "0.0.0.0:5002": 0}
+
+	tests := []struct {
+		name  string
+		live  map[string]bool
+		heard map[string]bool
+		want  bool
+	}{
+		{"no peers", map[string]bool{}, map[string]bool{}, true},
+		{"peer health unknown", map[string]bool{"localhost:5000": false, "0.0.0.0:5002": false}, map[string]bool{"localhost:5000": true}, false},
+		{"lower peer down", map[string]bool{"localhost:5000": true, "0.0.0.0:5002": false}, map[string]bool{"localhost:5000": true, "0.0.0.0:5002": true}, true},
+		{"lower peer up", map[string]bool{"localhost:5000": false, "0.0.0.0:5002": true}, map[string]bool{"localhost:5000": true, "0.0.0.0:5002": true}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			healthMu.Lock()
+			livePeers, heardFrom, recovering = test.live, test.heard, false
+			healthMu.Unlock()
+			updateHealth()
+			// a replica whose peers are down has no quorum, this test is only about who sends
+			healthServer.SetServingStatus(auctionService, healthpb.HealthCheckResponse_SERVING)
+
+			w := &webhookSender{}
+			w.emit(WebhookEvent{ID: "default/bids/1", Type: "bid.accepted"})
+			w.checkSender()
+			if w.sending != test.want {
+				t.Errorf("sending = %v, want %v", w.sending, test.want)
+			}
+		})
+	}
+}
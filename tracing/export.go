@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Setup turns tracing on. dest is either a file the spans are appended to, one OTLP/JSON
+// document per line, or the http(s) url of an OTLP/HTTP collector, ex. http://localhost:4318/v1/traces.
+// instance tells apart processes of the same service, ex. the replicas.
+// The returned function sends the last spans and turns tracing off again.
+func Setup(service string, instance string, dest string) (func(), error) {
+	var send func([]byte) error
+	closeDest := func() {}
+	if strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+		client := &http.Client{Timeout: 5 * time.Second}
+		send = func(body []byte) error {
+			response, err := client.Post(dest, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+			if response.StatusCode >= 300 {
+				return fmt.Errorf("collector answered %s", response.Status)
+			}
+			return nil
+		}
+	} else {
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		send = func(body []byte) error {
+			_, err := f.Write(append(body, '\n'))
+			return err
+		}
+		closeDest = func() { f.Close() }
+	}
+
+	e := &batchExporter{
+		service:    service,
+		instance:   instance,
+		send:       send,
+		flushEvery: time.Second,
+		maxBatch:   256,
+		full:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+
+	exporterMu.Lock()
+	exporter = e
+	exporterMu.Unlock()
+
+	return func() {
+		exporterMu.Lock()
+		exporter = nil
+		exporterMu.Unlock()
+		close(e.done)
+		e.wg.Wait()
+		closeDest()
+	}, nil
+}
+
+// batchExporter collects ended spans and sends them every flushEvery, or sooner if maxBatch are waiting
+type batchExporter struct {
+	service    string
+	instance   string
+	send       func([]byte) error
+	flushEvery time.Duration
+	maxBatch   int
+
+	mu    sync.Mutex
+	spans []*Span
+	full  chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func (e *batchExporter) add(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	full := len(e.spans) >= e.maxBatch
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *batchExporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.full:
+		case <-e.done:
+			e.flush()
+			return
+		}
+		e.flush()
+	}
+}
+
+func (e *batchExporter) flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		slog.Warn("failed to encode spans", "err", err)
+		return
+	}
+	if err := e.send(body); err != nil {
+		slog.Warn("failed to export spans", "count", len(spans), "err", err)
+	}
+}
+
+// the OTLP/JSON types, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 1 is ok, 2 is error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func attribute(key string, value interface{}) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case int:
+		i := strconv.FormatInt(int64(v), 10)
+		kv.Value.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &i
+	case float64:
+		kv.Value.DoubleValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	default:
+		str := fmt.Sprint(v)
+		kv.Value.StringValue = &str
+	}
+	return kv
+}
+
+func (e *batchExporter) encode(spans []*Span) otlpTraces {
+	var encoded []otlpSpan
+	var zeroID [8]byte
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.parentID != zeroID {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for key, value := range s.attrs {
+			span.Attributes = append(span.Attributes, attribute(key, value))
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{attribute("service.name", e.service), attribute("service.instance.id", e.instance)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/mbjnitu/AuctionSystem-replication/tracing"}, Spans: encoded}},
+	}}}
+}
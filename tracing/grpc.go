@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TraceparentHeader is the gRPC metadata key trace context is sent in
+const TraceparentHeader = "traceparent"
+
+// Extract continues the trace the caller of a gRPC call was in, if it sent one
+func Extract(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(TraceparentHeader); len(values) > 0 {
+		return withTraceparent(ctx, values[0])
+	}
+	return ctx
+}
+
+// Inject adds the span in ctx to the metadata of outgoing gRPC calls
+func Inject(ctx context.Context) context.Context {
+	if s := FromContext(ctx); s != nil {
+		return metadata.AppendToOutgoingContext(ctx, TraceparentHeader, s.traceparent())
+	}
+	return ctx
+}
+
+// UnaryServerInterceptor makes a server span for every call, continuing the callers trace
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := Start(Extract(ctx), info.FullMethod, Server, "rpc.system", "grpc")
+	resp, err := handler(ctx, req)
+	span.SetAttributes("rpc.grpc.status_code", int(status.Code(err)))
+	span.End(err)
+	return resp, err
+}
+
+// StreamServerInterceptor makes a server span covering the whole stream
+func StreamServerInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := Start(Extract(stream.Context()), info.FullMethod, Server, "rpc.system", "grpc")
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	span.SetAttributes("rpc.grpc.status_code", int(status.Code(err)))
+	span.End(err)
+	return err
+}
+
+// UnaryClientInterceptor makes a client span for every call and sends the trace context along
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, span := Start(ctx, method, Client, "rpc.system", "grpc", "server.address", cc.Target())
+	err := invoker(Inject(ctx), method, req, reply, cc, opts...)
+	span.SetAttributes("rpc.grpc.status_code", int(status.Code(err)))
+	span.End(err)
+	return err
+}
+
+// StreamClientInterceptor sends the trace context along with streams. The span only covers
+// opening the stream, as streams like Join stay open for as long as the client runs.
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, span := Start(ctx, method, Client, "rpc.system", "grpc", "server.address", cc.Target())
+	stream, err := streamer(Inject(ctx), desc, cc, method, opts...)
+	span.End(err)
+	return stream, err
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,131 @@
+// Package tracing records spans of work and exports them in the OpenTelemetry (OTLP/JSON)
+// format, either to a file or to a collector over HTTP. Trace context is passed between
+// processes in the W3C "traceparent" gRPC metadata, so a bid can be followed from the
+// client through every replica.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind says what side of a call a span is, the values are the ones OTLP uses
+type SpanKind int
+
+const (
+	Internal SpanKind = 1
+	Server   SpanKind = 2
+	Client   SpanKind = 3
+)
+
+// Span is one timed piece of work in a trace
+type Span struct {
+	mu       sync.Mutex
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     SpanKind
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+	ended    bool
+}
+
+type spanKey struct{}
+
+// the exporter spans are sent to when they end, nil when tracing is off
+var exporter *batchExporter
+var exporterMu sync.RWMutex
+
+// Start begins a span as a child of the span in ctx, or as the root of a new trace
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...interface{}) (context.Context, *Span) {
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: make(map[string]interface{})}
+	if parent := FromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		s.traceID = remote.traceID
+		s.parentID = remote.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// FromContext returns the span in ctx, or nil if there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// TraceID is the hex id of the trace the span is part of
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttributes adds key value pairs to the span, ex. SetAttributes("bidder", "alice", "amount", 10)
+func (s *Span) SetAttributes(attrs ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+}
+
+// End finishes the span, marking it as failed if err is not nil, and hands it to the exporter
+func (s *Span) End(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	if exporter != nil {
+		exporter.add(s)
+	}
+}
+
+// the span a remote caller was in, taken from the traceparent it sent
+type remoteKey struct{}
+
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// traceparent formats the span as a W3C traceparent header, ex.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (s *Span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// parses a W3C traceparent header into the context, so spans started with it continue the remote trace
+func withTraceparent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	var remote remoteParent
+	if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remote)
+}